@@ -1,26 +1,83 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/pAran0k/calc_go/env"
 	"github.com/pAran0k/calc_go/internal/services/agent"
+	"github.com/pAran0k/calc_go/pkg/logging"
+	"github.com/pAran0k/calc_go/pkg/tracing"
 )
 
 func main() {
-	config := env.LoadConfig()
+	config, err := env.LoadAgentConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if config.PrintConfig {
+		if err := env.Print(os.Stdout, config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := logging.Setup(config.LogOptions()); err != nil {
+		slog.Error("logging setup failed", "error", err)
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "calc-agent", config.OTLPEndpoint)
+	if err != nil {
+		slog.Error("tracing setup failed", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
 	stop := make(chan struct{})
-	agt := agent.NewAgent()
+	drained := make(chan struct{})
+	agt := agent.NewAgent(config)
 	go func() {
-		log.Printf("Агент запущен с %d вычислителями", config.ComputingPower)
 		agt.Run(stop)
+		close(drained)
 	}()
+
+	server := &http.Server{Addr: config.AgentAddr, Handler: agt.Handler()}
+	go func() {
+		slog.Info("agent http server listening", "addr", config.AgentAddr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("agent http server failed", "error", err)
+		}
+	}()
+
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		reloaded, err := env.LoadAgentConfig(os.Args[1:])
+		if err != nil {
+			slog.Error("config reload failed", "error", err)
+			continue
+		}
+		agt.Reload(reloaded)
+		slog.Info("config reloaded", "operation_costs", reloaded.OperationCosts())
+	}
 	close(stop)
-	log.Println("Приложение остановлено")
+	<-drained
+	server.Shutdown(context.Background())
+	slog.Info("application stopped")
 }
@@ -2,27 +2,59 @@ package main
 
 import (
 	"context"
-
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/pAran0k/calc_go/env"
 	"github.com/pAran0k/calc_go/internal/services/orchestrator"
+	"github.com/pAran0k/calc_go/pkg/logging"
+	"github.com/pAran0k/calc_go/pkg/tracing"
 )
 
 func main() {
-	config := env.LoadConfig()
+	config, err := env.LoadOrchestratorConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if config.PrintConfig {
+		if err := env.Print(os.Stdout, config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := logging.Setup(config.LogOptions()); err != nil {
+		slog.Error("logging setup failed", "error", err)
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "calc-orchestrator", config.OTLPEndpoint)
+	if err != nil {
+		slog.Error("tracing setup failed", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	orch := orchestrator.NewOrchestrator(config.OrchestratorAddr)
+	orch := orchestrator.NewOrchestrator(config)
+	stopped := make(chan struct{})
 	go func() {
-		log.Printf("Оркестратор запущен на %s", config.OrchestratorAddr)
+		defer close(stopped)
+		slog.Info("orchestrator started", "addr", config.OrchestratorAddr)
 		if err := orch.Run(ctx); err != nil {
-			log.Printf("Ошибка оркестратора: %v", err)
+			slog.Error("orchestrator failed", "error", err)
 		}
 	}()
 
@@ -30,7 +62,8 @@ func main() {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
 
-	log.Println("Получен сигнал остановки")
+	slog.Info("shutdown signal received")
 	cancel()
-	log.Println("Приложение остановлено")
+	<-stopped
+	slog.Info("application stopped")
 }
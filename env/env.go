@@ -1,42 +1,273 @@
 package env
 
 import (
-	"os"
-	"strconv"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/pAran0k/calc_go/models"
+	"github.com/pAran0k/calc_go/pkg/logging"
 )
 
-type Config struct {
-	ComputingPower       int
-	TimeAdditionMS       int
-	TimeSubtractionMS    int
-	TimeMultiplicationMS int
-	TimeDivisionMS       int
-	OrchestratorAddr     string
+// Every setting can come from four layers, later ones winning: the defaults
+// below, a YAML file, environment variables and command-line flags. The
+// yaml, env and flag tags name the setting in each layer.
+
+type Common struct {
+	ConfigFile  string `yaml:"-" env:"CONFIG_FILE" flag:"config" usage:"path to a YAML config file"`
+	PrintConfig bool   `yaml:"-" flag:"print-config" usage:"print the effective configuration and exit"`
+
+	OrchestratorAddr    string `yaml:"orchestrator_addr" env:"ORCHESTRATOR_ADDR" flag:"orchestrator-addr" usage:"orchestrator address"`
+	OTLPEndpoint        string `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" flag:"otlp-endpoint" usage:"OTLP/HTTP collector URL for traces, empty to disable"`
+	LogLevel            string `yaml:"log_level" env:"LOG_LEVEL" flag:"log-level" usage:"log level: debug, info, warn or error"`
+	LogFormat           string `yaml:"log_format" env:"LOG_FORMAT" flag:"log-format" usage:"log format: json, text or console"`
+	LogLang             string `yaml:"log_lang" env:"LOG_LANG" flag:"log-lang" usage:"console log language: en or ru"`
+	LogSampleFirst      int    `yaml:"log_sample_first" env:"LOG_SAMPLE_FIRST" flag:"log-sample-first" usage:"identical log records per second written before sampling, 0 disables sampling"`
+	LogSampleThereafter int    `yaml:"log_sample_thereafter" env:"LOG_SAMPLE_THEREAFTER" flag:"log-sample-thereafter" usage:"after that, write every Nth record"`
+
+	// On the orchestrator these seed the operation cost table handed out with
+	// tasks; an agent uses its own only when the orchestrator sends none.
+	TimeAdditionMS       int `yaml:"time_addition_ms" env:"TIME_ADDITION_MS" flag:"time-addition-ms" usage:"addition time in milliseconds"`
+	TimeSubtractionMS    int `yaml:"time_subtraction_ms" env:"TIME_SUBTRACTION_MS" flag:"time-subtraction-ms" usage:"subtraction time in milliseconds"`
+	TimeMultiplicationMS int `yaml:"time_multiplication_ms" env:"TIME_MULTIPLICATIONS_MS" flag:"time-multiplication-ms" usage:"multiplication time in milliseconds"`
+	TimeDivisionMS       int `yaml:"time_division_ms" env:"TIME_DIVISIONS_MS" flag:"time-division-ms" usage:"division time in milliseconds"`
 }
 
-func LoadConfig() Config {
-	return Config{
-		ComputingPower:       getEnvInt("COMPUTING_POWER", 1),
-		TimeAdditionMS:       getEnvInt("TIME_ADDITION_MS", 100),
-		TimeSubtractionMS:    getEnvInt("TIME_SUBTRACTION_MS", 100),
-		TimeMultiplicationMS: getEnvInt("TIME_MULTIPLICATIONS_MS", 100),
-		TimeDivisionMS:       getEnvInt("TIME_DIVISIONS_MS", 100),
-		OrchestratorAddr:     getEnvString("ORCHESTRATOR_ADDR", ":8080"),
+type OrchestratorConfig struct {
+	Common `yaml:",inline"`
+
+	ResultCacheSize            int    `yaml:"result_cache_size" env:"RESULT_CACHE_SIZE" flag:"result-cache-size" usage:"LRU cache size for subexpression results, 0 disables it"`
+	ExpressionTTLSec           int    `yaml:"expression_ttl_sec" env:"EXPRESSION_TTL_SEC" flag:"expression-ttl-sec" usage:"seconds to keep finished expressions, 0 keeps them forever"`
+	MaxExpressions             int    `yaml:"max_expressions" env:"MAX_EXPRESSIONS" flag:"max-expressions" usage:"maximum stored expressions, 0 for no limit"`
+	GCIntervalSec              int    `yaml:"gc_interval_sec" env:"GC_INTERVAL_SEC" flag:"gc-interval-sec" usage:"background purge period in seconds, 0 disables it"`
+	WebhookSecret              string `yaml:"webhook_secret" env:"WEBHOOK_SECRET" flag:"webhook-secret" usage:"HMAC key for webhook signatures" secret:"true"`
+	WebhookMaxAttempts         int    `yaml:"webhook_max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" flag:"webhook-max-attempts" usage:"webhook delivery attempts"`
+	WebhookBackoffMS           int    `yaml:"webhook_backoff_ms" env:"WEBHOOK_BACKOFF_MS" flag:"webhook-backoff-ms" usage:"initial delay between webhook attempts"`
+	WebhookAllowPrivateTargets bool   `yaml:"webhook_allow_private_targets" env:"WEBHOOK_ALLOW_PRIVATE_TARGETS" flag:"webhook-allow-private-targets" usage:"let callbacks reach loopback, private and link-local addresses"`
+	ReadyMaxQueuedTasks        int    `yaml:"ready_max_queued_tasks" env:"READY_MAX_QUEUED_TASKS" flag:"ready-max-queued-tasks" usage:"queued tasks that fail readiness, 0 disables the check"`
+	ReadyMaxActiveExpressions  int    `yaml:"ready_max_active_expressions" env:"READY_MAX_ACTIVE_EXPRESSIONS" flag:"ready-max-active-expressions" usage:"unfinished expressions that fail readiness, 0 disables the check"`
+	TaskLeaseSec               int    `yaml:"task_lease_sec" env:"TASK_LEASE_SEC" flag:"task-lease-sec" usage:"seconds on top of the operation time an agent may hold a task without contacting the orchestrator before the task is queued again"`
+	ShutdownTimeoutSec         int    `yaml:"shutdown_timeout_sec" env:"SHUTDOWN_TIMEOUT_SEC" flag:"shutdown-timeout-sec" usage:"upper bound for graceful shutdown"`
+	ShutdownWaitTasks          bool   `yaml:"shutdown_wait_tasks" env:"SHUTDOWN_WAIT_TASKS" flag:"shutdown-wait-tasks" usage:"wait for dispatched tasks on shutdown"`
+	SnapshotPath               string `yaml:"snapshot_path" env:"SNAPSHOT_PATH" flag:"snapshot-path" usage:"file for the store snapshot, empty disables it"`
+	LeaderLockPath             string `yaml:"leader_lock_path" env:"LEADER_LOCK_PATH" flag:"leader-lock-path" usage:"lock file shared by replicas for leader election, empty runs a single instance"`
+	ReplicaID                  string `yaml:"replica_id" env:"REPLICA_ID" flag:"replica-id" usage:"replica identifier for leader election, generated when empty"`
+	ReplicaURL                 string `yaml:"replica_url" env:"REPLICA_URL" flag:"replica-url" usage:"URL other replicas forward requests to while this one leads, derived from orchestrator_addr when empty"`
+	WSAllowedOrigins           string `yaml:"ws_allowed_origins" env:"WS_ALLOWED_ORIGINS" flag:"ws-allowed-origins" usage:"comma-separated origins besides the orchestrator's own allowed to open WebSocket connections"`
+}
+
+type AgentConfig struct {
+	Common `yaml:",inline"`
+
+	AgentID             string `yaml:"agent_id" env:"AGENT_ID" flag:"agent-id" usage:"agent identifier, generated when empty"`
+	AgentAddr           string `yaml:"agent_addr" env:"AGENT_ADDR" flag:"agent-addr" usage:"address of the agent metrics and health server"`
+	ComputingPower      int    `yaml:"computing_power" env:"COMPUTING_POWER" flag:"computing-power" usage:"number of parallel workers"`
+	AgentDrainTimeoutMS int    `yaml:"agent_drain_timeout_ms" env:"AGENT_DRAIN_TIMEOUT_MS" flag:"agent-drain-timeout-ms" usage:"time to finish tasks on shutdown before releasing them"`
+	AgentOperations     string `yaml:"agent_operations" env:"AGENT_OPERATIONS" flag:"agent-operations" usage:"comma-separated operations this agent runs, empty for all"`
+	AgentLabels         string `yaml:"agent_labels" env:"AGENT_LABELS" flag:"agent-labels" usage:"comma-separated labels offered to tasks that require them"`
+}
+
+func defaultCommon() Common {
+	return Common{
+		OrchestratorAddr:     ":8080",
+		LogLevel:             "info",
+		LogFormat:            "json",
+		LogLang:              "en",
+		LogSampleFirst:       100,
+		LogSampleThereafter:  100,
+		TimeAdditionMS:       100,
+		TimeSubtractionMS:    100,
+		TimeMultiplicationMS: 100,
+		TimeDivisionMS:       100,
+	}
+}
+
+func DefaultOrchestratorConfig() OrchestratorConfig {
+	return OrchestratorConfig{
+		Common:              defaultCommon(),
+		ResultCacheSize:     1000,
+		ExpressionTTLSec:    3600,
+		MaxExpressions:      10000,
+		GCIntervalSec:       60,
+		WebhookMaxAttempts:  5,
+		WebhookBackoffMS:    500,
+		ReadyMaxQueuedTasks: 10000,
+		TaskLeaseSec:        30,
+		ShutdownTimeoutSec:  30,
 	}
 }
 
-func getEnvInt(key string, defaultValue int) int {
-	if value, exists := os.LookupEnv(key); exists {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+func DefaultAgentConfig() AgentConfig {
+	return AgentConfig{
+		Common:              defaultCommon(),
+		AgentAddr:           ":8081",
+		ComputingPower:      1,
+		AgentDrainTimeoutMS: 30000,
+	}
+}
+
+func LoadOrchestratorConfig(args []string) (OrchestratorConfig, error) {
+	config := DefaultOrchestratorConfig()
+	if err := load("orchestrator", &config, args); err != nil {
+		return config, err
+	}
+	return config, config.Validate()
+}
+
+func LoadAgentConfig(args []string) (AgentConfig, error) {
+	config := DefaultAgentConfig()
+	if err := load("agent", &config, args); err != nil {
+		return config, err
+	}
+	return config, config.Validate()
+}
+
+func (c Common) LogOptions() logging.Options {
+	return logging.Options{
+		Level:            c.LogLevel,
+		Format:           c.LogFormat,
+		Lang:             c.LogLang,
+		SampleFirst:      c.LogSampleFirst,
+		SampleThereafter: c.LogSampleThereafter,
+	}
+}
+
+func (c Common) OperationCosts() models.OperationCosts {
+	return models.OperationCosts{
+		AdditionMS:       c.TimeAdditionMS,
+		SubtractionMS:    c.TimeSubtractionMS,
+		MultiplicationMS: c.TimeMultiplicationMS,
+		DivisionMS:       c.TimeDivisionMS,
+	}
+}
+
+func (c OrchestratorConfig) AllowedOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(c.WSAllowedOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
 		}
 	}
-	return defaultValue
+	return origins
+}
+
+// AdvertisedURL is the URL other replicas reach this one at.
+func (c OrchestratorConfig) AdvertisedURL() string {
+	if c.ReplicaURL != "" {
+		return c.ReplicaURL
+	}
+	host, port, err := net.SplitHostPort(c.OrchestratorAddr)
+	if err != nil {
+		return ""
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+func (c AgentConfig) Capabilities() (models.Capabilities, error) {
+	return models.ParseCapabilities(c.AgentOperations, c.AgentLabels)
+}
+
+func (c Common) validate(v *validator) {
+	v.address("orchestrator_addr", c.OrchestratorAddr)
+	if c.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.fail("otlp_endpoint", "must be an http(s) URL, got %q", c.OTLPEndpoint)
+		}
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		v.fail("log_level", "must be one of debug, info, warn, error, got %q", c.LogLevel)
+	}
+	v.oneOf("log_format", c.LogFormat, "json", "text", "console")
+	v.oneOf("log_lang", c.LogLang, "en", "ru")
+	v.min("log_sample_first", c.LogSampleFirst, 0)
+	v.min("log_sample_thereafter", c.LogSampleThereafter, 0)
+	v.min("time_addition_ms", c.TimeAdditionMS, 0)
+	v.min("time_subtraction_ms", c.TimeSubtractionMS, 0)
+	v.min("time_multiplication_ms", c.TimeMultiplicationMS, 0)
+	v.min("time_division_ms", c.TimeDivisionMS, 0)
+}
+
+func (c OrchestratorConfig) Validate() error {
+	v := &validator{}
+	c.Common.validate(v)
+	v.min("result_cache_size", c.ResultCacheSize, 0)
+	v.min("expression_ttl_sec", c.ExpressionTTLSec, 0)
+	v.min("max_expressions", c.MaxExpressions, 0)
+	v.min("gc_interval_sec", c.GCIntervalSec, 0)
+	v.min("webhook_max_attempts", c.WebhookMaxAttempts, 1)
+	v.min("webhook_backoff_ms", c.WebhookBackoffMS, 0)
+	v.min("ready_max_queued_tasks", c.ReadyMaxQueuedTasks, 0)
+	v.min("ready_max_active_expressions", c.ReadyMaxActiveExpressions, 0)
+	v.min("task_lease_sec", c.TaskLeaseSec, 1)
+	v.min("shutdown_timeout_sec", c.ShutdownTimeoutSec, 1)
+	for _, origin := range c.AllowedOrigins() {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			v.fail("ws_allowed_origins", "must list scheme://host origins, got %q", origin)
+		}
+	}
+	if c.LeaderLockPath != "" && c.SnapshotPath == "" {
+		v.fail("snapshot_path", "must be set to a file shared by the replicas when leader_lock_path is set")
+	}
+	if c.ReplicaURL != "" {
+		if u, err := url.Parse(c.ReplicaURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.fail("replica_url", "must be an http(s) URL, got %q", c.ReplicaURL)
+		}
+	}
+	return v.err()
+}
+
+func (c AgentConfig) Validate() error {
+	v := &validator{}
+	c.Common.validate(v)
+	v.address("agent_addr", c.AgentAddr)
+	v.min("computing_power", c.ComputingPower, 1)
+	v.min("agent_drain_timeout_ms", c.AgentDrainTimeoutMS, 0)
+	if _, err := models.ParseCapabilities(c.AgentOperations, ""); err != nil {
+		v.fail("agent_operations", "%v", err)
+	}
+	if _, err := models.ParseCapabilities("", c.AgentLabels); err != nil {
+		v.fail("agent_labels", "%v", err)
+	}
+	return v.err()
+}
+
+type validator struct {
+	errs []error
+}
+
+func (v *validator) fail(key, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+}
+
+func (v *validator) min(key string, value, min int) {
+	if value < min {
+		v.fail(key, "must be at least %d, got %d", min, value)
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if strings.EqualFold(value, a) {
+			return
+		}
+	}
+	v.fail(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (v *validator) address(key, value string) {
+	if _, _, err := net.SplitHostPort(value); err != nil {
+		v.fail(key, "must be host:port or :port, got %q", value)
+	}
 }
 
-func getEnvString(key string, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
 	}
-	return defaultValue
+	return fmt.Errorf("invalid configuration:\n%w", errors.Join(v.errs...))
 }
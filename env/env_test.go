@@ -0,0 +1,94 @@
+package env
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadLayers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	file := "computing_power: 2\ntime_addition_ms: 10\ntime_division_ms: 20\nagent_id: from-file\n"
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("TIME_ADDITION_MS", "30")
+	t.Setenv("AGENT_ID", "from-env")
+
+	config, err := LoadAgentConfig([]string{"-agent-id", "from-flag"})
+	if err != nil {
+		t.Fatalf("LoadAgentConfig unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"default", config.TimeSubtractionMS, 100},
+		{"file", config.ComputingPower, 2},
+		{"file", config.TimeDivisionMS, 20},
+		{"env over file", config.TimeAdditionMS, 30},
+		{"flag over env", config.AgentID, "from-flag"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orchestrator.yaml")
+	if err := os.WriteFile(path, []byte("gc_interval: 5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"bad env", map[string]string{"MAX_EXPRESSIONS": "many"}, nil, `environment variable MAX_EXPRESSIONS: invalid integer "many"`},
+		{"bad flag", nil, []string{"-shutdown-wait-tasks=maybe"}, "shutdown-wait-tasks"},
+		{"unknown file key", nil, []string{"-config", path}, "field gc_interval not found"},
+		{"positional args", nil, []string{"extra"}, "unexpected arguments"},
+		{"validation", nil, []string{"-ready-max-queued-tasks", "-1", "-log-format", "xml"}, "ready_max_queued_tasks: must be at least 0, got -1"},
+		{"validation", nil, []string{"-ready-max-queued-tasks", "-1", "-log-format", "xml"}, `log_format: must be one of json, text, console, got "xml"`},
+		{"address", map[string]string{"ORCHESTRATOR_ADDR": "localhost"}, nil, `orchestrator_addr: must be host:port`},
+		{"replicas", map[string]string{"LEADER_LOCK_PATH": "/tmp/leader.lock"}, nil, "snapshot_path: must be set to a file shared by the replicas"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := LoadOrchestratorConfig(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadOrchestratorConfig() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintMasksSecrets(t *testing.T) {
+	config := DefaultOrchestratorConfig()
+	config.WebhookSecret = "hunter2"
+
+	var buf bytes.Buffer
+	if err := Print(&buf, config); err != nil {
+		t.Fatalf("Print unexpected error: %v", err)
+	}
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("Print leaked the webhook secret:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "gc_interval_sec: 60") {
+		t.Errorf("Print output misses gc_interval_sec:\n%s", buf.String())
+	}
+	if config.WebhookSecret != "hunter2" {
+		t.Errorf("Print modified the config")
+	}
+}
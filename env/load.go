@@ -0,0 +1,168 @@
+package env
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+type setting struct {
+	value  reflect.Value
+	key    string
+	env    string
+	flag   string
+	usage  string
+	secret bool
+}
+
+func settings(v reflect.Value) []setting {
+	var result []setting
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			result = append(result, settings(v.Field(i))...)
+			continue
+		}
+		result = append(result, setting{
+			value:  v.Field(i),
+			key:    field.Tag.Get("yaml"),
+			env:    field.Tag.Get("env"),
+			flag:   field.Tag.Get("flag"),
+			usage:  field.Tag.Get("usage"),
+			secret: field.Tag.Get("secret") == "true",
+		})
+	}
+	return result
+}
+
+func (s setting) set(raw, source string) error {
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%s: invalid integer %q", source, raw)
+		}
+		s.value.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: invalid boolean %q", source, raw)
+		}
+		s.value.SetBool(b)
+	default:
+		return fmt.Errorf("%s: unsupported setting type %s", source, s.value.Kind())
+	}
+	return nil
+}
+
+type flagValue struct {
+	setting setting
+	raw     string
+}
+
+// load fills config, which already holds the defaults, from the config file,
+// the environment and args, in that order.
+func load(name string, config any, args []string) error {
+	all := settings(reflect.ValueOf(config).Elem())
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	var flags []flagValue
+	for _, s := range all {
+		if s.flag == "" {
+			continue
+		}
+		usage := s.usage
+		if s.env != "" {
+			usage += " (env " + s.env + ")"
+		}
+		record := func(raw string) error {
+			flags = append(flags, flagValue{setting: s, raw: raw})
+			return nil
+		}
+		if s.value.Kind() == reflect.Bool {
+			fs.BoolFunc(s.flag, usage, record)
+		} else {
+			if !s.value.IsZero() {
+				usage += fmt.Sprintf(" (default %v)", s.value.Interface())
+			}
+			fs.Func(s.flag, usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	path, _ := os.LookupEnv("CONFIG_FILE")
+	for _, f := range flags {
+		if f.setting.flag == "config" {
+			path = f.raw
+		}
+	}
+	if path != "" {
+		if err := loadFile(path, config); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range all {
+		if s.env == "" {
+			continue
+		}
+		if raw, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(raw, "environment variable "+s.env); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range flags {
+		if err := f.setting.set(f.raw, "flag -"+f.setting.flag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadFile(path string, config any) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Print writes config as YAML with secrets masked.
+func Print(w io.Writer, config any) error {
+	masked := reflect.New(reflect.TypeOf(config)).Elem()
+	masked.Set(reflect.ValueOf(config))
+	for _, s := range settings(masked) {
+		if s.secret && !s.value.IsZero() {
+			s.value.SetString("********")
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(masked.Interface()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -2,34 +2,71 @@ package agent
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/pAran0k/calc_go/env"
 	"github.com/pAran0k/calc_go/models"
+	"github.com/pAran0k/calc_go/pkg/logging"
+	"github.com/pAran0k/calc_go/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	errTaskCancelled        = errors.New("task cancelled")
+	errDivisionByZero       = errors.New("division by zero")
+	errUnsupportedOperation = errors.New("unsupported operation")
+	errDrainDeadline        = errors.New("drain deadline exceeded")
+	errTaskExpired          = errors.New("task deadline exceeded")
+)
+
+const (
+	releaseTimeout     = 2 * time.Second
+	cancelPollInterval = 500 * time.Millisecond
 )
 
 type Agent struct {
-	ind    int
-	Tasks  []chan models.Task
-	IsFree []bool
-	Work   []models.Task
-	Config env.Config
-	Client *http.Client
-	wg     sync.WaitGroup
+	log      *slog.Logger
+	ID       string
+	Tasks    []chan models.Task
+	IsFree   []bool
+	freeMu   sync.Mutex
+	Work     []models.Task
+	Config   env.AgentConfig
+	configMu sync.RWMutex
+	// costs is the latest operation cost table received from the
+	// orchestrator; it takes precedence over the agent's own config.
+	costs    atomic.Pointer[models.OperationCosts]
+	caps     models.Capabilities
+	Client   *http.Client
+	Metrics  *prometheus.Registry
+	metrics  *agentMetrics
+	wg       sync.WaitGroup
+	lastPoll atomic.Int64
+	draining atomic.Bool
+	// ctx is cancelled when the drain deadline passes; work still running
+	// then is abandoned and handed back to the orchestrator.
+	ctx   context.Context
+	abort context.CancelFunc
 }
 
-func NewAgent() *Agent {
-	config := env.LoadConfig()
+func NewAgent(config env.AgentConfig) *Agent {
 	numWorkers := config.ComputingPower
 
 	agent := &Agent{
-		ind:    1,
+		ID:     config.AgentID,
 		Tasks:  make([]chan models.Task, numWorkers),
 		IsFree: make([]bool, numWorkers),
 		Work:   make([]models.Task, numWorkers),
@@ -37,7 +74,18 @@ func NewAgent() *Agent {
 		Client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		Metrics: prometheus.NewRegistry(),
 	}
+	agent.metrics = newAgentMetrics(agent.Metrics, numWorkers)
+	// LoadAgentConfig has validated the lists; a hand-built config with bad
+	// ones leaves the agent declaring nothing, that is every operation.
+	agent.caps, _ = config.Capabilities()
+
+	if agent.ID == "" {
+		agent.ID = uuid.NewString()
+	}
+	agent.log = slog.With(logging.KeyAgentID, agent.ID)
+	agent.ctx, agent.abort = context.WithCancel(context.Background())
 
 	for i := 0; i < numWorkers; i++ {
 		agent.Tasks[i] = make(chan models.Task, 1)
@@ -48,88 +96,249 @@ func NewAgent() *Agent {
 }
 
 func (a *Agent) Run(stop <-chan struct{}) {
-	log.Printf("Запуск агента %d с %d вычислителями", a.ind, len(a.Tasks))
+	a.log.Info("agent started", "workers", len(a.Tasks), "operations", a.caps.Operations, "labels", a.caps.Labels)
 
 	for i := 0; i < len(a.Tasks); i++ {
 		a.wg.Add(1)
-		go a.worker(i, a.Tasks[i], stop)
+		go a.worker(i, a.Tasks[i])
 	}
 
-	baseURL := "http://localhost" + a.Config.OrchestratorAddr
+	baseURL := a.orchestratorURL()
 	for {
 		select {
 		case <-stop:
-			for i := 0; i < len(a.Tasks); i++ {
-				close(a.Tasks[i])
-			}
-			a.wg.Wait()
+			a.drain()
 			return
 		default:
+			a.lastPoll.Store(time.Now().UnixNano())
 			workerID := a.getFreeWorker()
 			if workerID == -1 {
-				time.Sleep(100 * time.Millisecond)
+				sleepOrStop(stop, 100*time.Millisecond)
 				continue
 			}
 
-			task, err := a.getTask(baseURL)
+			task, err := a.getTask(baseURL, workerID)
 			if err != nil {
 				if err.Error() == "no task available" {
-					time.Sleep(1 * time.Second)
+					sleepOrStop(stop, 1*time.Second)
 					continue
 				}
-				log.Printf("[Агент %d] Ошибка при получении задачи: %v", a.ind, err)
+				a.log.Warn("task fetch failed", "error", err)
+				a.metrics.fetchErrors.Inc()
+				continue
+			}
+
+			select {
+			case <-stop:
+				a.giveBack(baseURL, -1, *task, "released")
 				continue
+			default:
 			}
 
-			log.Printf("[Агент %d] Получена задача %s для вычислителя %d", a.ind, task.ID, workerID)
+			a.log.Debug("task received", logging.KeyTaskID, task.ID, logging.KeyWorker, workerID)
+			a.freeMu.Lock()
 			a.IsFree[workerID] = false
+			a.freeMu.Unlock()
+			a.metrics.busy.Add(1)
 			a.Work[workerID] = *task
 			a.Tasks[workerID] <- *task
 		}
 	}
 }
 
-func (a *Agent) worker(workerID int, taskChan <-chan models.Task, stop <-chan struct{}) {
-	defer a.wg.Done()
-	baseURL := "http://localhost" + a.Config.OrchestratorAddr
+// drain stops handing out work and lets the workers finish what they hold.
+// Whatever is still running when the grace period ends is released back to
+// the orchestrator so another agent can take it.
+func (a *Agent) drain() {
+	grace := time.Duration(a.Config.AgentDrainTimeoutMS) * time.Millisecond
+	a.draining.Store(true)
+	a.log.Info("agent draining", "grace", grace)
+	for i := 0; i < len(a.Tasks); i++ {
+		close(a.Tasks[i])
+	}
+
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-done:
+		a.log.Info("agent drained")
+		return
+	case <-timer.C:
+	}
+
+	a.log.Warn("drain deadline reached, releasing in-flight tasks")
+	a.abort()
+	select {
+	case <-done:
+	case <-time.After(releaseTimeout):
+		a.log.Error("agent stopped with unreleased tasks")
+	}
+}
+
+func sleepOrStop(stop <-chan struct{}, d time.Duration) {
+	select {
+	case <-stop:
+	case <-time.After(d):
+	}
+}
+
+// sleep waits for d unless ctx, which derives from a.ctx, ends first.
+func (a *Agent) sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return a.interrupted()
+	case <-time.After(d):
+		return nil
+	}
+}
 
+// interrupted tells why a task context ended: the drain deadline cancels
+// every task, otherwise the task ran out of its own time budget.
+func (a *Agent) interrupted() error {
+	if a.ctx.Err() != nil {
+		return errDrainDeadline
+	}
+	return errTaskExpired
+}
+
+// wait sleeps for a task's operation time. While it waits, the agent polls
+// the orchestrator so that a cancelled task is abandoned right away rather
+// than after the full operation time.
+func (a *Agent) wait(ctx context.Context, baseURL, taskID string, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	var poll <-chan time.Time
+	if d > cancelPollInterval {
+		ticker := time.NewTicker(cancelPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
 	for {
 		select {
-		case <-stop:
-			return
-		case task := <-taskChan:
-			log.Printf("[Агент %d] Вычислитель %d: Принята задача %s: %+v", a.ind, workerID, task.ID, task)
-			result, err := a.processTask(&task, baseURL)
-			if err != nil {
-				log.Printf("[Агент %d] Вычислитель %d: Ошибка при обработке задачи %s: %v", a.ind, workerID, task.ID, err)
-				a.IsFree[workerID] = true
-				continue
+		case <-ctx.Done():
+			return a.interrupted()
+		case <-timer.C:
+			return nil
+		case <-poll:
+			if _, err := a.getTaskResult(ctx, baseURL, taskID); errors.Is(err, errTaskCancelled) {
+				return errTaskCancelled
 			}
+		}
+	}
+}
 
-			log.Printf("[Агент %d] Вычислитель %d: Результат задачи %s готов к отправке: %f", a.ind, workerID, task.ID, result.Value)
-			for retries := 0; retries < 5; retries++ {
-				err = a.sendResult(baseURL, result)
-				if err != nil {
-					log.Printf("[Агент %d] Вычислитель %d: Ошибка при отправке результата для задачи %s: %v, попытка %d", a.ind, workerID, task.ID, err, retries+1)
-					time.Sleep(500 * time.Millisecond)
-					continue
-				}
-				log.Printf("[Агент %d] Вычислитель %d: Результат %s отправлен: %f", a.ind, workerID, task.ID, result.Value)
+func (a *Agent) worker(workerID int, taskChan <-chan models.Task) {
+	defer a.wg.Done()
+	baseURL := a.orchestratorURL()
+
+	for task := range taskChan {
+		if a.ctx.Err() != nil {
+			a.giveBack(baseURL, workerID, task, "released")
+			continue
+		}
+
+		a.log.Debug("task started", logging.KeyTaskID, task.ID, logging.KeyWorker, workerID, "operation", task.Operation)
+		result, err := a.processTask(&task, baseURL)
+		outcome := "completed"
+		if errors.Is(err, errTaskCancelled) {
+			a.log.Info("task cancelled by orchestrator", logging.KeyTaskID, task.ID, logging.KeyWorker, workerID)
+			a.release(workerID, task.Operation, "cancelled")
+			continue
+		}
+		if errors.Is(err, errTaskExpired) {
+			// The orchestrator times the expression out on its own; handing
+			// the task back stops it from waiting for this agent meanwhile.
+			a.log.Info("task deadline exceeded", logging.KeyTaskID, task.ID, logging.KeyWorker, workerID, "timeout_ms", task.TimeoutMS)
+			a.giveBack(baseURL, workerID, task, "expired")
+			continue
+		}
+		if errors.Is(err, errDrainDeadline) {
+			a.giveBack(baseURL, workerID, task, "released")
+			continue
+		}
+		if errors.Is(err, errDivisionByZero) || errors.Is(err, errUnsupportedOperation) {
+			a.log.Info("task cannot be computed", logging.KeyTaskID, task.ID, logging.KeyWorker, workerID, "error", err)
+			result = &models.Result{TaskID: task.ID, Error: err.Error()}
+			outcome = "failed"
+			err = nil
+		}
+		if err != nil {
+			a.log.Error("task processing failed", logging.KeyTaskID, task.ID, logging.KeyWorker, workerID, "error", err)
+			a.giveBack(baseURL, workerID, task, "error")
+			continue
+		}
+
+		ctx := tracing.ExtractMap(a.ctx, task.Trace)
+		for retries := 0; retries < 5; retries++ {
+			err = a.sendResult(ctx, baseURL, result)
+			if errors.Is(err, errTaskCancelled) || errors.Is(err, errDrainDeadline) {
 				break
 			}
 			if err != nil {
-				log.Printf("[Агент %d] Вычислитель %d: Не удалось отправить результат для задачи %s после всех попыток: %v", a.ind, workerID, task.ID, err)
-				a.IsFree[workerID] = true
+				a.log.Warn("result delivery failed", logging.KeyTaskID, task.ID, logging.KeyWorker, workerID, "attempt", retries+1, "error", err)
+				if err = a.sleep(ctx, 500*time.Millisecond); err != nil {
+					break
+				}
 				continue
 			}
-
-			log.Printf("[Агент %d] Вычислитель %d: Задача %s выполнена: %f", a.ind, workerID, task.ID, result.Value)
-			a.IsFree[workerID] = true
+			break
+		}
+		if errors.Is(err, errTaskCancelled) {
+			a.log.Info("task cancelled, result discarded", logging.KeyTaskID, task.ID, logging.KeyWorker, workerID)
+			a.release(workerID, task.Operation, "cancelled")
+			continue
+		}
+		if errors.Is(err, errDrainDeadline) {
+			a.giveBack(baseURL, workerID, task, "released")
+			continue
+		}
+		if err != nil {
+			a.log.Error("result delivery gave up", logging.KeyTaskID, task.ID, logging.KeyWorker, workerID, "error", err)
+			a.release(workerID, task.Operation, "error")
+			continue
 		}
+
+		a.log.Debug("task done", logging.KeyTaskID, task.ID, logging.KeyWorker, workerID, "outcome", outcome, "value", result.Value)
+		a.release(workerID, task.Operation, outcome)
+	}
+}
+
+// giveBack hands an unfinished task back to the orchestrator and frees the
+// worker, counting the task under outcome. workerID is -1 for a task that was
+// fetched but never assigned to a worker.
+func (a *Agent) giveBack(baseURL string, workerID int, task models.Task, outcome string) {
+	if err := a.releaseTask(baseURL, task); err != nil {
+		a.log.Error("task release failed", logging.KeyTaskID, task.ID, logging.KeyWorker, workerID, "error", err)
+	} else {
+		a.log.Info("task released to orchestrator", logging.KeyTaskID, task.ID, logging.KeyWorker, workerID)
+	}
+	if workerID >= 0 {
+		a.release(workerID, task.Operation, outcome)
 	}
 }
 
+func (a *Agent) release(workerID int, operation, outcome string) {
+	a.metrics.tasksProcessed.WithLabelValues(operation, outcome).Inc()
+	a.metrics.busy.Add(-1)
+	a.freeMu.Lock()
+	a.IsFree[workerID] = true
+	a.freeMu.Unlock()
+}
+
+func (a *Agent) orchestratorURL() string {
+	return "http://localhost" + a.Config.OrchestratorAddr
+}
+
 func (a *Agent) getFreeWorker() int {
+	a.freeMu.Lock()
+	defer a.freeMu.Unlock()
 	for i, free := range a.IsFree {
 		if free {
 			return i
@@ -138,8 +347,23 @@ func (a *Agent) getFreeWorker() int {
 	return -1
 }
 
-func (a *Agent) getTask(baseURL string) (*models.Task, error) {
-	resp, err := a.Client.Get(baseURL + "/internal/task")
+func (a *Agent) getTask(baseURL string, workerID int) (*models.Task, error) {
+	start := time.Now()
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/internal/task", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(models.AgentIDHeader, a.ID)
+	req.Header.Set(models.AgentWorkerHeader, strconv.Itoa(workerID))
+	// The orchestrator only hands out tasks matching what the agent declares.
+	if len(a.caps.Operations) > 0 {
+		req.Header.Set(models.AgentOperationsHeader, strings.Join(a.caps.Operations, ","))
+	}
+	if len(a.caps.Labels) > 0 {
+		req.Header.Set(models.AgentLabelsHeader, strings.Join(a.caps.Labels, ","))
+	}
+
+	resp, err := a.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -153,18 +377,56 @@ func (a *Agent) getTask(baseURL string) (*models.Task, error) {
 	}
 
 	var response struct {
-		Task models.Task `json:"task"`
+		Task           models.Task            `json:"task"`
+		OperationCosts *models.OperationCosts `json:"operation_costs"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		return nil, err
 	}
+	if response.OperationCosts != nil {
+		a.costs.Store(response.OperationCosts)
+	}
+	// A task without operation_time comes from an orchestrator that predates
+	// it; the cost table, the orchestrator's or our own, gives the time then.
+	// With the orchestrator's table a zero cost stays zero either way.
+	if response.Task.OperationTime == 0 {
+		cost, _ := a.operationCosts().For(response.Task.Operation)
+		response.Task.OperationTime = int(cost / time.Millisecond)
+	}
+
+	// The trace is only known once the orchestrator hands out a task, so the
+	// span is started retroactively under the dispatch span from the response.
+	ctx, span := tracing.Start(tracing.Extract(context.Background(), resp.Header), "agent.getTask",
+		trace.WithTimestamp(start),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("task.id", response.Task.ID),
+			attribute.String("agent.id", a.ID),
+			attribute.Int("agent.worker", workerID),
+		))
+	span.End()
+	response.Task.Trace = tracing.InjectMap(ctx)
 
 	return &response.Task, nil
 }
 
-func (a *Agent) processTask(task *models.Task, baseURL string) (*models.Result, error) {
+func (a *Agent) processTask(task *models.Task, baseURL string) (result *models.Result, err error) {
+	ctx, span := tracing.Start(tracing.ExtractMap(a.ctx, task.Trace), "agent.processTask",
+		trace.WithAttributes(
+			attribute.String("task.id", task.ID),
+			attribute.String("task.operation", task.Operation),
+		))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+	if task.TimeoutMS > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(task.TimeoutMS)*time.Millisecond)
+		defer cancel()
+	}
+
 	var arg1, arg2 float64
-	var err error
 
 	if isNumeric(task.Arg1) {
 		arg1, err = strconv.ParseFloat(task.Arg1, 64)
@@ -173,12 +435,17 @@ func (a *Agent) processTask(task *models.Task, baseURL string) (*models.Result,
 		}
 	} else {
 		for retries := 0; retries < 5; retries++ {
-			arg1, err = a.getTaskResult(baseURL, task.Arg1)
-			if err == nil {
+			arg1, err = a.getTaskResult(ctx, baseURL, task.Arg1)
+			if err == nil || errors.Is(err, errTaskCancelled) {
 				break
 			}
-			log.Printf("[Агент %d] Ожидание результата для %s: %v, попытка %d", a.ind, task.Arg1, err, retries+1)
-			time.Sleep(1 * time.Second)
+			a.log.Debug("waiting for dependency result", logging.KeyTaskID, task.ID, "dependency", task.Arg1, "attempt", retries+1, "error", err)
+			if err := a.sleep(ctx, time.Second); err != nil {
+				return nil, err
+			}
+		}
+		if errors.Is(err, errTaskCancelled) {
+			return nil, err
 		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to get result for Arg1 %s after retries: %v", task.Arg1, err)
@@ -192,12 +459,17 @@ func (a *Agent) processTask(task *models.Task, baseURL string) (*models.Result,
 		}
 	} else {
 		for retries := 0; retries < 5; retries++ {
-			arg2, err = a.getTaskResult(baseURL, task.Arg2)
-			if err == nil {
+			arg2, err = a.getTaskResult(ctx, baseURL, task.Arg2)
+			if err == nil || errors.Is(err, errTaskCancelled) {
 				break
 			}
-			log.Printf("[Агент %d] Ожидание результата для %s: %v, попытка %d", a.ind, task.Arg2, err, retries+1)
-			time.Sleep(1 * time.Second)
+			a.log.Debug("waiting for dependency result", logging.KeyTaskID, task.ID, "dependency", task.Arg2, "attempt", retries+1, "error", err)
+			if err := a.sleep(ctx, time.Second); err != nil {
+				return nil, err
+			}
+		}
+		if errors.Is(err, errTaskCancelled) {
+			return nil, err
 		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to get result for Arg2 %s after retries: %v", task.Arg2, err)
@@ -205,28 +477,25 @@ func (a *Agent) processTask(task *models.Task, baseURL string) (*models.Result,
 	}
 
 	var value float64
-	var operationTime int
 	switch task.Operation {
 	case "+":
 		value = arg1 + arg2
-		operationTime = a.Config.TimeAdditionMS
 	case "-":
 		value = arg1 - arg2
-		operationTime = a.Config.TimeSubtractionMS
 	case "*":
 		value = arg1 * arg2
-		operationTime = a.Config.TimeMultiplicationMS
 	case "/":
 		if arg2 == 0 {
-			return nil, fmt.Errorf("division by zero")
+			return nil, errDivisionByZero
 		}
 		value = arg1 / arg2
-		operationTime = a.Config.TimeDivisionMS
 	default:
-		return nil, fmt.Errorf("unsupported operation: %s", task.Operation)
+		return nil, fmt.Errorf("%w: %s", errUnsupportedOperation, task.Operation)
 	}
 
-	time.Sleep(time.Duration(operationTime) * time.Millisecond)
+	if err := a.wait(ctx, baseURL, task.ID, time.Duration(task.OperationTime)*time.Millisecond); err != nil {
+		return nil, err
+	}
 
 	return &models.Result{
 		TaskID: task.ID,
@@ -234,14 +503,45 @@ func (a *Agent) processTask(task *models.Task, baseURL string) (*models.Result,
 	}, nil
 }
 
-func (a *Agent) getTaskResult(baseURL, taskID string) (float64, error) {
-	url := baseURL + "/internal/task/result/" + taskID
-	resp, err := a.Client.Get(url)
+func (a *Agent) operationCosts() models.OperationCosts {
+	if costs := a.costs.Load(); costs != nil {
+		return *costs
+	}
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.Config.OperationCosts()
+}
+
+// Reload applies the settings of config that can change at runtime: the
+// operation times used for tasks that arrive without one while the
+// orchestrator has sent no cost table. Everything else
+// needs a restart.
+func (a *Agent) Reload(config env.AgentConfig) {
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+	a.Config.TimeAdditionMS = config.TimeAdditionMS
+	a.Config.TimeSubtractionMS = config.TimeSubtractionMS
+	a.Config.TimeMultiplicationMS = config.TimeMultiplicationMS
+	a.Config.TimeDivisionMS = config.TimeDivisionMS
+}
+
+func (a *Agent) getTaskResult(ctx context.Context, baseURL, taskID string) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/internal/task/result/"+taskID, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set(models.AgentIDHeader, a.ID)
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := a.Client.Do(req)
 	if err != nil {
 		return 0, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusGone {
+		return 0, errTaskCancelled
+	}
 	if resp.StatusCode != http.StatusOK {
 		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
@@ -256,41 +556,97 @@ func (a *Agent) getTaskResult(baseURL, taskID string) (float64, error) {
 	return response.Result, nil
 }
 
-func (a *Agent) sendResult(baseURL string, result *models.Result) error {
-	body, err := json.Marshal(result)
-	if err != nil {
-		return err
-	}
+func (a *Agent) sendResult(ctx context.Context, baseURL string, result *models.Result) (err error) {
+	ctx, span := tracing.Start(ctx, "agent.sendResult", trace.WithAttributes(attribute.String("task.id", result.TaskID)))
+	defer func() {
+		span.SetAttributes(attribute.Int("result.attempts", result.Attempts))
+		tracing.RecordError(span, err)
+		span.End()
+	}()
 
 	maxRetries := 5
 	for retries := 0; retries < maxRetries; retries++ {
-		resp, err := a.Client.Post(baseURL+"/internal/task", "application/json", bytes.NewBuffer(body))
+		result.Attempts = retries + 1
+		if retries > 0 {
+			a.metrics.resultRetries.Inc()
+		}
+		body, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/internal/task", bytes.NewReader(body))
 		if err != nil {
-			log.Printf("[Агент %d] Ошибка отправки результата %s: %v, попытка %d", a.ind, result.TaskID, err, retries+1)
-			time.Sleep(500 * time.Millisecond)
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(models.AgentIDHeader, a.ID)
+		tracing.Inject(ctx, req.Header)
+
+		resp, err := a.Client.Do(req)
+		if err != nil {
+			a.log.Debug("result request failed", logging.KeyTaskID, result.TaskID, "attempt", retries+1, "error", err)
+			if err := a.sleep(ctx, 500*time.Millisecond); err != nil {
+				return err
+			}
 			continue
 		}
 		defer resp.Body.Close()
 
 		switch resp.StatusCode {
 		case http.StatusOK:
-			log.Printf("[Агент %d] Результат %s отправлен: %f", a.ind, result.TaskID, result.Value)
+			a.log.Debug("result sent", logging.KeyTaskID, result.TaskID, "value", result.Value)
 			return nil
+		case http.StatusGone:
+			return errTaskCancelled
 		case http.StatusInternalServerError:
-			log.Printf("[Агент %d] Ошибка сервера 500 для задачи %s, попытка %d", a.ind, result.TaskID, retries+1)
-			time.Sleep(1 * time.Second)
+			a.log.Debug("orchestrator error on result", logging.KeyTaskID, result.TaskID, "attempt", retries+1)
+			if err := a.sleep(ctx, time.Second); err != nil {
+				return err
+			}
 			continue
 		default:
-			log.Printf("[Агент %d] Неожиданный код ответа %d для задачи %s", a.ind, resp.StatusCode, result.TaskID)
+			a.log.Warn("unexpected status for result", logging.KeyTaskID, result.TaskID, "status", resp.StatusCode)
 			return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 		}
 	}
 
-	log.Printf("[Агент %d] Не удалось отправить результат %s после %d попыток", a.ind, result.TaskID, maxRetries)
 	return fmt.Errorf("failed to send result after %d retries", maxRetries)
 
 }
 
+func (a *Agent) releaseTask(baseURL string, task models.Task) error {
+	ctx, cancel := context.WithTimeout(tracing.ExtractMap(context.Background(), task.Trace), releaseTimeout)
+	defer cancel()
+	ctx, span := tracing.Start(ctx, "agent.releaseTask", trace.WithAttributes(attribute.String("task.id", task.ID)))
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/internal/task/release/"+task.ID, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(models.AgentIDHeader, a.ID)
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusGone, http.StatusNotFound, http.StatusConflict:
+		// Cancelled, timed out or already completed tasks need no handing
+		// back.
+		return nil
+	default:
+		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		tracing.RecordError(span, err)
+		return err
+	}
+}
+
 func isNumeric(arg string) bool {
 	_, err := strconv.ParseFloat(arg, 64)
 	return err == nil
@@ -1,30 +1,33 @@
 package agent
 
 import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/pAran0k/calc_go/env"
 	"github.com/pAran0k/calc_go/models"
 )
 
 func TestProcessTask(t *testing.T) {
-	agent := NewAgent()
-	// Устанавливаем значения конфигурации для теста
-	agent.Config.TimeAdditionMS = 100
-	agent.Config.TimeSubtractionMS = 150
-	agent.Config.TimeMultiplicationMS = 200
-	agent.Config.TimeDivisionMS = 250
+	agent := NewAgent(env.DefaultAgentConfig())
 
 	tests := []struct {
 		task     *models.Task
 		expected float64
 		wantErr  bool
 	}{
-		{&models.Task{ID: "task-1", Arg1: "2", Arg2: "3", Operation: "+"}, 5, false},
-		{&models.Task{ID: "task-2", Arg1: "4", Arg2: "0", Operation: "/"}, 0, true},
+		{&models.Task{ID: "task-1", Arg1: "2", Arg2: "3", Operation: "+", OperationTime: 30}, 5, false},
+		{&models.Task{ID: "task-2", Arg1: "4", Arg2: "0", Operation: "/", OperationTime: 30}, 0, true},
+		{&models.Task{ID: "task-3", Arg1: "4", Arg2: "5", Operation: "*", OperationTime: 60}, 20, false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.task.ID, func(t *testing.T) {
+			start := time.Now()
 			result, err := agent.processTask(tt.task, "http://fake-url")
 			if tt.wantErr {
 				if err == nil {
@@ -37,7 +40,96 @@ func TestProcessTask(t *testing.T) {
 				if result.Value != tt.expected {
 					t.Errorf("processTask(%+v) = %f, want %f", tt.task, result.Value, tt.expected)
 				}
+				if elapsed, want := time.Since(start), time.Duration(tt.task.OperationTime)*time.Millisecond; elapsed < want {
+					t.Errorf("processTask(%+v) took %s, want at least the task's operation_time %s", tt.task, elapsed, want)
+				}
 			}
 		})
 	}
 }
+
+func TestGetTaskOperationTime(t *testing.T) {
+	var body string
+	orchestrator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer orchestrator.Close()
+
+	config := env.DefaultAgentConfig()
+	agent := NewAgent(config)
+	config.TimeDivisionMS = 700
+	agent.Reload(config)
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"task": {"id": "task-1", "operation": "/", "operation_time": 50}}`, 50},
+		{`{"task": {"id": "task-1", "operation": "/"}}`, 700},
+		{`{"task": {"id": "task-1", "operation": "/", "operation_time": 0}, "operation_costs": {"division_ms": 0}}`, 0},
+		{`{"task": {"id": "task-1", "operation": "/"}, "operation_costs": {"division_ms": 300}}`, 300},
+		// The orchestrator's table, once received, beats the agent's own.
+		{`{"task": {"id": "task-1", "operation": "/"}}`, 300},
+	}
+	for _, tt := range tests {
+		body = tt.body
+		task, err := agent.getTask(orchestrator.URL, 0)
+		if err != nil {
+			t.Fatalf("getTask unexpected error: %v", err)
+		}
+		if task.OperationTime != tt.want {
+			t.Errorf("getTask(%s).OperationTime = %d, want %d", tt.body, task.OperationTime, tt.want)
+		}
+	}
+}
+
+func TestGetTaskDeclaresCapabilities(t *testing.T) {
+	var operations, labels string
+	orchestrator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operations, labels = r.Header.Get(models.AgentOperationsHeader), r.Header.Get(models.AgentLabelsHeader)
+		http.Error(w, "No task available", http.StatusNotFound)
+	}))
+	defer orchestrator.Close()
+
+	config := env.DefaultAgentConfig()
+	config.AgentOperations = "/, *"
+	config.AgentLabels = "Slow,bignum"
+	NewAgent(config).getTask(orchestrator.URL, 0)
+	if operations != "/,*" || labels != "bignum,slow" {
+		t.Errorf("declared operations %q and labels %q, want \"/,*\" and \"bignum,slow\"", operations, labels)
+	}
+}
+
+func TestProcessTaskStopsOnCancellation(t *testing.T) {
+	orchestrator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/internal/task/result/task-1" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		http.Error(w, "Task cancelled", http.StatusGone)
+	}))
+	defer orchestrator.Close()
+
+	agent := NewAgent(env.DefaultAgentConfig())
+	task := &models.Task{ID: "task-1", Arg1: "2", Arg2: "3", Operation: "+", OperationTime: int(time.Minute / time.Millisecond)}
+
+	start := time.Now()
+	if _, err := agent.processTask(task, orchestrator.URL); !errors.Is(err, errTaskCancelled) {
+		t.Fatalf("processTask error = %v, want %v", err, errTaskCancelled)
+	}
+	if elapsed := time.Since(start); elapsed > 2*cancelPollInterval {
+		t.Errorf("processTask returned after %v, want within %v", elapsed, 2*cancelPollInterval)
+	}
+}
+
+func TestProcessTaskStopsAtTimeout(t *testing.T) {
+	agent := NewAgent(env.DefaultAgentConfig())
+	task := &models.Task{ID: "task-1", Arg1: "2", Arg2: "3", Operation: "+", OperationTime: int(time.Minute / time.Millisecond), TimeoutMS: 50}
+
+	start := time.Now()
+	if _, err := agent.processTask(task, "http://fake-url"); !errors.Is(err, errTaskExpired) {
+		t.Fatalf("processTask error = %v, want %v", err, errTaskExpired)
+	}
+	if elapsed := time.Since(start); elapsed > cancelPollInterval {
+		t.Errorf("processTask returned after %v, want about 50ms", elapsed)
+	}
+}
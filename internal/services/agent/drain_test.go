@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+)
+
+func TestDrainReleasesUnfinishedTask(t *testing.T) {
+	var dispatched atomic.Bool
+	released := make(chan string, 1)
+	orchestrator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/internal/task":
+			if dispatched.Swap(true) {
+				http.Error(w, "No task available", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(struct {
+				Task models.Task `json:"task"`
+			}{Task: models.Task{ID: "task-expr-1-0", Arg1: "2", Arg2: "3", Operation: "+", OperationTime: int(time.Minute / time.Millisecond)}})
+		case r.Method == http.MethodPost && r.URL.Path == "/internal/task/release/task-expr-1-0":
+			released <- r.Header.Get(models.AgentIDHeader)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer orchestrator.Close()
+	orchestratorURL, _ := url.Parse(orchestrator.URL)
+
+	agt := NewAgent(env.DefaultAgentConfig())
+	agt.Config.OrchestratorAddr = ":" + orchestratorURL.Port()
+	agt.Config.AgentDrainTimeoutMS = 100
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		agt.Run(stop)
+		close(done)
+	}()
+
+	for deadline := time.Now().Add(2 * time.Second); !dispatched.Load(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("agent did not fetch the task")
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("agent did not stop within the drain deadline")
+	}
+	select {
+	case agentID := <-released:
+		if agentID != agt.ID {
+			t.Errorf("release sent by agent %q, want %q", agentID, agt.ID)
+		}
+	default:
+		t.Error("unfinished task was not released")
+	}
+}
+
+func TestWorkerReleasesTaskItCannotFinish(t *testing.T) {
+	tests := []struct {
+		name string
+		task models.Task
+	}{
+		{"deadline exceeded", models.Task{ID: "task-expr-1-0", Arg1: "2", Arg2: "3", Operation: "+", OperationTime: int(time.Minute / time.Millisecond), TimeoutMS: 50}},
+		{"dependency unavailable", models.Task{ID: "task-expr-1-0", Arg1: "task-expr-1-1", Arg2: "3", Operation: "+"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dispatched atomic.Bool
+			released := make(chan string, 1)
+			orchestrator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/internal/task":
+					if dispatched.Swap(true) {
+						http.Error(w, "No task available", http.StatusNotFound)
+						return
+					}
+					json.NewEncoder(w).Encode(struct {
+						Task models.Task `json:"task"`
+					}{Task: tt.task})
+				case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/internal/task/result/"):
+					http.Error(w, "Internal error", http.StatusInternalServerError)
+				case r.Method == http.MethodPost && r.URL.Path == "/internal/task/release/task-expr-1-0":
+					released <- r.Header.Get(models.AgentIDHeader)
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					http.NotFound(w, r)
+				}
+			}))
+			defer orchestrator.Close()
+			orchestratorURL, _ := url.Parse(orchestrator.URL)
+
+			agt := NewAgent(env.DefaultAgentConfig())
+			agt.Config.OrchestratorAddr = ":" + orchestratorURL.Port()
+
+			stop := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				agt.Run(stop)
+				close(done)
+			}()
+			defer func() {
+				close(stop)
+				<-done
+			}()
+
+			// The orchestrator must get the task back without waiting for
+			// its lease to run out.
+			select {
+			case agentID := <-released:
+				if agentID != agt.ID {
+					t.Errorf("release sent by agent %q, want %q", agentID, agt.ID)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("task the agent could not finish was not released")
+			}
+		})
+	}
+}
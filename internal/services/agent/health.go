@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pAran0k/calc_go/pkg/health"
+)
+
+const (
+	healthCheckTimeout = 2 * time.Second
+	// The poll loop sleeps at most a second between iterations, but a single
+	// fetch can take up to the client timeout.
+	maxPollStaleness = time.Minute
+)
+
+func (a *Agent) livenessChecks() []health.Check {
+	return []health.Check{{Name: "poll_loop", Run: a.checkPollLoop}}
+}
+
+func (a *Agent) readinessChecks() []health.Check {
+	return []health.Check{
+		{Name: "poll_loop", Run: a.checkPollLoop},
+		{Name: "draining", Run: a.checkDraining},
+		{Name: "orchestrator", Run: a.checkOrchestrator},
+		{Name: "workers", Run: a.checkWorkers},
+	}
+}
+
+func (a *Agent) checkPollLoop(context.Context) (string, error) {
+	last := a.lastPoll.Load()
+	if last == 0 {
+		return "", fmt.Errorf("poll loop not started")
+	}
+	since := time.Since(time.Unix(0, last))
+	if since > maxPollStaleness {
+		return "", fmt.Errorf("last poll %s ago", since.Round(time.Second))
+	}
+	return fmt.Sprintf("last poll %s ago", since.Round(time.Millisecond)), nil
+}
+
+func (a *Agent) checkDraining(context.Context) (string, error) {
+	if a.draining.Load() {
+		return "", fmt.Errorf("agent is draining")
+	}
+	return "", nil
+}
+
+func (a *Agent) checkOrchestrator(ctx context.Context) (string, error) {
+	url := a.orchestratorURL() + "/healthz"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return url, nil
+}
+
+func (a *Agent) checkWorkers(context.Context) (string, error) {
+	busy, total := int(a.metrics.busy.Load()), len(a.Tasks)
+	detail := fmt.Sprintf("%d/%d workers busy", busy, total)
+	if busy >= total {
+		return detail, fmt.Errorf("all workers busy")
+	}
+	return detail, nil
+}
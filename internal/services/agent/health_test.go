@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/pkg/health"
+)
+
+func TestReadiness(t *testing.T) {
+	orchestrator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer orchestrator.Close()
+	orchestratorURL, _ := url.Parse(orchestrator.URL)
+
+	agt := NewAgent(env.DefaultAgentConfig())
+	agt.Config.OrchestratorAddr = ":" + orchestratorURL.Port()
+
+	probe := func() (int, health.Report) {
+		rec := httptest.NewRecorder()
+		agt.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var report health.Report
+		json.NewDecoder(rec.Body).Decode(&report)
+		return rec.Code, report
+	}
+
+	if code, report := probe(); code != http.StatusServiceUnavailable || report.Checks["poll_loop"].Status != health.StatusFail {
+		t.Errorf("before Run: /readyz = %d %+v, want 503 with failing poll_loop", code, report)
+	}
+
+	agt.lastPoll.Store(time.Now().UnixNano())
+	if code, report := probe(); code != http.StatusOK {
+		t.Errorf("/readyz = %d %+v, want 200", code, report)
+	}
+
+	agt.metrics.busy.Store(int64(len(agt.Tasks)))
+	if code, report := probe(); code != http.StatusServiceUnavailable || report.Checks["workers"].Status != health.StatusFail {
+		t.Errorf("saturated: /readyz = %d %+v, want 503 with failing workers", code, report)
+	}
+	agt.metrics.busy.Store(0)
+
+	orchestrator.Close()
+	if code, report := probe(); code != http.StatusServiceUnavailable || report.Checks["orchestrator"].Status != health.StatusFail {
+		t.Errorf("orchestrator down: /readyz = %d %+v, want 503 with failing orchestrator", code, report)
+	}
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/pAran0k/calc_go/pkg/health"
+	"github.com/pAran0k/calc_go/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type agentMetrics struct {
+	// busy backs calc_agent_busy_workers and the readiness check.
+	busy           atomic.Int64
+	tasksProcessed *prometheus.CounterVec
+	resultRetries  prometheus.Counter
+	fetchErrors    prometheus.Counter
+}
+
+func newAgentMetrics(registry *prometheus.Registry, workers int) *agentMetrics {
+	m := &agentMetrics{
+		tasksProcessed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "calc_agent_tasks_processed_total",
+			Help: "Tasks processed by the agent.",
+		}, []string{"operation", "outcome"}),
+		resultRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "calc_agent_result_submission_retries_total",
+			Help: "Retries of result submissions to the orchestrator.",
+		}),
+		fetchErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "calc_agent_task_fetch_errors_total",
+			Help: "Failed attempts to fetch a task from the orchestrator.",
+		}),
+	}
+	registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "calc_agent_workers",
+			Help: "Number of workers configured on the agent.",
+		}, func() float64 { return float64(workers) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "calc_agent_busy_workers",
+			Help: "Workers currently processing a task.",
+		}, func() float64 { return float64(m.busy.Load()) }),
+		m.tasksProcessed, m.resultRetries, m.fetchErrors,
+	)
+	return m
+}
+
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(a.Metrics))
+	mux.Handle("/healthz", health.Handler(healthCheckTimeout, a.livenessChecks()...))
+	mux.Handle("/readyz", health.Handler(healthCheckTimeout, a.readinessChecks()...))
+	return mux
+}
@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/internal/services/orchestrator"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestExpressionProducesSingleTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	config := env.DefaultOrchestratorConfig()
+	config.TimeAdditionMS = 0
+	config.TimeMultiplicationMS = 0
+	orch := orchestrator.NewOrchestrator(config)
+	server := httptest.NewServer(orch.Handler())
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+
+	resp, err := http.Post(server.URL+"/api/v1/calculate", "application/json", strings.NewReader(`{"expression": "(1+2)*(3+4)"}`))
+	if err != nil {
+		t.Fatalf("POST /calculate: %v", err)
+	}
+	var created struct {
+		ID int `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+
+	agt := NewAgent(env.DefaultAgentConfig())
+	agt.Config.OrchestratorAddr = ":" + serverURL.Port()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		agt.Run(stop)
+		close(done)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	expr, err := orch.Store.WaitExpression(ctx, created.ID)
+	close(stop)
+	<-done
+	if err != nil {
+		t.Fatalf("WaitExpression: %v", err)
+	}
+	if expr.Result != 21 {
+		t.Fatalf("expression result = %f, want 21", expr.Result)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) == 0 {
+		t.Fatal("no spans recorded")
+	}
+	traceID := spans[0].SpanContext.TraceID()
+	names := make(map[string]int)
+	for _, span := range spans {
+		if span.SpanContext.TraceID() != traceID {
+			t.Errorf("span %q has trace %s, want %s", span.Name, span.SpanContext.TraceID(), traceID)
+		}
+		names[span.Name]++
+	}
+
+	for name, want := range map[string]int{
+		"orchestrator.calculate":  1,
+		"calc.BuildTasks":         1,
+		"orchestrator.dispatch":   3,
+		"agent.getTask":           3,
+		"agent.processTask":       3,
+		"agent.sendResult":        3,
+		"orchestrator.taskResult": 3,
+	} {
+		if names[name] != want {
+			t.Errorf("got %d %q spans, want %d", names[name], name, want)
+		}
+	}
+	if names["orchestrator.dependencyResult"] < 2 {
+		t.Errorf("got %d dependency result spans, want at least 2", names["orchestrator.dependencyResult"])
+	}
+}
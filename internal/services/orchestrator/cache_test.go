@@ -0,0 +1,89 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+	calculations "github.com/pAran0k/calc_go/pkg/calc"
+)
+
+func TestResultCacheEviction(t *testing.T) {
+	cache := NewResultCache(2)
+	cache.Add("a", 1)
+	cache.Add("b", 2)
+	cache.Get("a")
+	cache.Add("c", 3)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("least recently used key b should be evicted")
+	}
+	if v, ok := cache.Get("a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %f, %v, want 1, true", v, ok)
+	}
+	if v, ok := cache.Get("c"); !ok || v != 3 {
+		t.Errorf("Get(c) = %f, %v, want 3, true", v, ok)
+	}
+}
+
+func TestStoreReusesCachedResults(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	task := models.Task{ID: "task-expr-1-0", Arg1: "2", Arg2: "3", Operation: "*", Hash: "h"}
+
+	st.AddExpression(models.Expression{Id: 1, Status: models.StatusProcessing, Node: &models.Node{Value: "*", Left: &models.Node{Value: "2"}, Right: &models.Node{Value: "3"}}})
+	if n := st.AddExpressionTasks(1, []models.Task{task}); n != 1 {
+		t.Fatalf("first expression scheduled %d tasks, want 1", n)
+	}
+
+	second := task
+	second.ID = "task-expr-2-0"
+	st.AddExpression(models.Expression{Id: 2, Status: models.StatusProcessing, Node: &models.Node{Value: "*", Left: &models.Node{Value: "2"}, Right: &models.Node{Value: "3"}}})
+	if n := st.AddExpressionTasks(2, []models.Task{second}); n != 0 {
+		t.Fatalf("identical in-flight task should be shared, scheduled %d", n)
+	}
+
+	if _, ok := st.GetPendingTask(); !ok {
+		t.Fatalf("shared task is not pending")
+	}
+	if err := st.UpdateTask(models.Result{TaskID: task.ID, Value: 6}, ""); err != nil {
+		t.Fatalf("UpdateTask unexpected error: %v", err)
+	}
+	for _, id := range []int{1, 2} {
+		expr, _ := st.GetExpression(id)
+		if expr.Status != models.StatusCompleted || expr.Result != 6 {
+			t.Errorf("expression %d = %+v, want completed with 6", id, expr)
+		}
+	}
+
+	third := task
+	third.ID = "task-expr-3-0"
+	st.AddExpression(models.Expression{Id: 3, Status: models.StatusProcessing, Node: &models.Node{Value: "*", Left: &models.Node{Value: "2"}, Right: &models.Node{Value: "3"}}})
+	if n := st.AddExpressionTasks(3, []models.Task{third}); n != 0 {
+		t.Fatalf("cached task should not be scheduled, scheduled %d", n)
+	}
+	if expr, _ := st.GetExpression(3); expr.Status != models.StatusCompleted || expr.Result != 6 {
+		t.Errorf("expression 3 = %+v, want completed from cache", expr)
+	}
+}
+
+func TestCachedSubtreeIsPruned(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	tree, err := calculations.ParseRPN("2 3 * 4 + 5 *")
+	if err != nil {
+		t.Fatalf("ParseRPN unexpected error: %v", err)
+	}
+	st.Cache.Add(calculations.HashNode(tree.Left), 10)
+
+	tasks, err := calculations.BuildTasks("expr-1", tree)
+	if err != nil {
+		t.Fatalf("BuildTasks unexpected error: %v", err)
+	}
+	st.AddExpression(models.Expression{Id: 1, Status: models.StatusProcessing, Node: tree})
+	if n := st.AddExpressionTasks(1, tasks); n != 1 {
+		t.Fatalf("scheduled %d tasks, want only the root once its operand subtree is cached", n)
+	}
+	task, ok := st.GetPendingTask()
+	if !ok || task.Operation != "*" || task.Arg1 != "10" {
+		t.Errorf("dispatched %+v, want 10*5", task)
+	}
+}
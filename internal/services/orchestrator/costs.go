@@ -0,0 +1,86 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/pAran0k/calc_go/models"
+)
+
+// OperationCosts returns the cost table used to set the operation time of
+// dispatched tasks.
+func (s *Store) OperationCosts() models.OperationCosts {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return s.costs
+}
+
+// SetOperationCosts replaces the cost table. Tasks dispatched afterwards
+// carry the new operation times; tasks already running keep the old ones.
+func (s *Store) SetOperationCosts(costs models.OperationCosts) error {
+	if err := costs.Validate(); err != nil {
+		return err
+	}
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.costs = costs
+	return nil
+}
+
+// PatchOperationCosts changes the costs set in patch and returns the new
+// table. The merge happens under the store lock, so concurrent patches of
+// different operations all take effect.
+func (s *Store) PatchOperationCosts(patch models.OperationCostsPatch) (models.OperationCosts, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	costs := patch.Apply(s.costs)
+	if err := costs.Validate(); err != nil {
+		return s.costs, err
+	}
+	s.costs = costs
+	return costs, nil
+}
+
+// handleOperationCosts serves the cost table. PUT replaces it, PATCH changes
+// only the fields present in the body.
+func (o *Orchestrator) handleOperationCosts(w http.ResponseWriter, r *http.Request) {
+	costs := o.Store.OperationCosts()
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPatch:
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		var err error
+		if r.Method == http.MethodPatch {
+			var patch models.OperationCostsPatch
+			if err := decoder.Decode(&patch); err != nil {
+				http.Error(w, "Invalid request", http.StatusUnprocessableEntity)
+				return
+			}
+			costs, err = o.Store.PatchOperationCosts(patch)
+		} else {
+			costs = models.OperationCosts{}
+			if err := decoder.Decode(&costs); err != nil {
+				http.Error(w, "Invalid request", http.StatusUnprocessableEntity)
+				return
+			}
+			err = o.Store.SetOperationCosts(costs)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		slog.Info("operation costs updated",
+			"addition_ms", costs.AdditionMS,
+			"subtraction_ms", costs.SubtractionMS,
+			"multiplication_ms", costs.MultiplicationMS,
+			"division_ms", costs.DivisionMS)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(costs)
+}
@@ -0,0 +1,91 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+)
+
+func TestOperationCostsAdminAPI(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	send := func(method, body string) (int, models.OperationCosts) {
+		rec := httptest.NewRecorder()
+		o.handleOperationCosts(rec, httptest.NewRequest(method, "/api/v1/admin/operation-costs", strings.NewReader(body)))
+		var costs models.OperationCosts
+		if rec.Code == http.StatusOK {
+			json.NewDecoder(rec.Body).Decode(&costs)
+		}
+		return rec.Code, costs
+	}
+
+	if code, costs := send(http.MethodGet, ""); code != http.StatusOK || costs.AdditionMS != 100 {
+		t.Fatalf("GET = %d %+v, want configured costs", code, costs)
+	}
+
+	code, costs := send(http.MethodPatch, `{"division_ms": 2000}`)
+	want := models.OperationCosts{AdditionMS: 100, SubtractionMS: 100, MultiplicationMS: 100, DivisionMS: 2000}
+	if code != http.StatusOK || costs != want {
+		t.Errorf("PATCH = %d %+v, want %+v", code, costs, want)
+	}
+
+	code, costs = send(http.MethodPut, `{"addition_ms": 5}`)
+	want = models.OperationCosts{AdditionMS: 5}
+	if code != http.StatusOK || costs != want {
+		t.Errorf("PUT = %d %+v, want %+v", code, costs, want)
+	}
+
+	for _, body := range []string{`{"addition_ms": -1}`, `{"modulo_ms": 1}`, `not json`} {
+		if code, _ := send(http.MethodPut, body); code != http.StatusUnprocessableEntity {
+			t.Errorf("PUT %s = %d, want 422", body, code)
+		}
+	}
+	if got := o.Store.OperationCosts(); got != want {
+		t.Errorf("rejected updates changed costs to %+v", got)
+	}
+
+	// The next dispatched task carries the new cost and the new table.
+	o.Store.AddExpressionTasks(1, []models.Task{{ID: "task-expr-1-0", Arg1: "2", Arg2: "3", Operation: "+"}})
+	rec := httptest.NewRecorder()
+	handleGetTask(rec, httptest.NewRequest(http.MethodGet, "/internal/task", nil), o.Store)
+	var response struct {
+		Task           models.Task            `json:"task"`
+		OperationCosts *models.OperationCosts `json:"operation_costs"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil || response.Task.OperationTime != 5 {
+		t.Errorf("dispatched operation_time = %d (%v), want 5", response.Task.OperationTime, err)
+	}
+	if response.OperationCosts == nil || *response.OperationCosts != want {
+		t.Errorf("dispatched costs = %+v, want %+v", response.OperationCosts, want)
+	}
+}
+
+func TestConcurrentPatchesAllApply(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	bodies := []string{`{"addition_ms": 1}`, `{"subtraction_ms": 2}`, `{"multiplication_ms": 3}`, `{"division_ms": 4}`}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		for _, body := range bodies {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rec := httptest.NewRecorder()
+				o.handleOperationCosts(rec, httptest.NewRequest(http.MethodPatch, "/api/v1/admin/operation-costs", strings.NewReader(body)))
+				if rec.Code != http.StatusOK {
+					t.Errorf("PATCH %s = %d, want 200", body, rec.Code)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	want := models.OperationCosts{AdditionMS: 1, SubtractionMS: 2, MultiplicationMS: 3, DivisionMS: 4}
+	if got := o.Store.OperationCosts(); got != want {
+		t.Errorf("costs after concurrent patches = %+v, want %+v", got, want)
+	}
+}
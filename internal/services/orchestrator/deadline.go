@@ -0,0 +1,95 @@
+package orchestrator
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/pAran0k/calc_go/models"
+	"github.com/pAran0k/calc_go/pkg/logging"
+)
+
+// requestDeadline turns the deadline or timeout of a calculate request into
+// an absolute deadline; nil means the expression may run indefinitely.
+func requestDeadline(req CalculateRequest, now time.Time) (*time.Time, error) {
+	switch {
+	case req.Deadline != nil && req.Timeout != "":
+		return nil, errors.New("set either deadline or timeout, not both")
+	case req.Deadline != nil:
+		if !req.Deadline.After(now) {
+			return nil, errors.New("deadline has already passed")
+		}
+		return req.Deadline, nil
+	case req.Timeout != "":
+		timeout, err := time.ParseDuration(req.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, errors.New("invalid timeout: " + req.Timeout)
+		}
+		deadline := now.Add(timeout)
+		return &deadline, nil
+	}
+	return nil, nil
+}
+
+// watchDeadline times the expression out once its deadline passes. Only the
+// leader expires expressions; a replica that takes over later watches the
+// deadlines again.
+func (o *Orchestrator) watchDeadline(expr models.Expression) {
+	if expr.Deadline == nil || expr.Status.IsFinal() {
+		return
+	}
+	time.AfterFunc(time.Until(*expr.Deadline), func() {
+		if o.IsLeader() {
+			o.Store.ExpireExpression(expr.Id)
+		}
+	})
+}
+
+// ExpireExpression fails an expression whose deadline has passed with
+// StatusTimedOut and drops the tasks no other expression is waiting for.
+// Agents working on those tasks learn about it the same way as about a
+// cancellation.
+func (s *Store) ExpireExpression(id int) bool {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	expr, exists := s.Expressions[id]
+	if !exists || expr.Status.IsFinal() || expr.Deadline == nil || time.Now().Before(*expr.Deadline) {
+		return false
+	}
+	expr.Status = models.StatusTimedOut
+	expr.Error = "deadline exceeded"
+	s.Expressions[id] = expr
+	s.markFinished(id)
+	dropped := s.releaseExpressionTasks(id)
+	s.dropStalePendingTasks()
+
+	slog.Info("expression timed out", logging.KeyExprID, id, "deadline", *expr.Deadline, "tasks_dropped", dropped)
+	return true
+}
+
+// taskBudget is the time left until the latest deadline of the expressions
+// waiting for the task, or zero when one of them has no deadline. When every
+// deadline has already passed the budget is 1ms, so that the agent gives up
+// at once instead of treating the task as unlimited. Callers hold s.Mu.
+func (s *Store) taskBudget(taskID string, now time.Time) time.Duration {
+	var budget time.Duration
+	found := false
+	for _, id := range s.taskExprs[taskID] {
+		expr, exists := s.Expressions[id]
+		if !exists {
+			continue
+		}
+		if expr.Deadline == nil {
+			return 0
+		}
+		if left := expr.Deadline.Sub(now); !found || left > budget {
+			budget = left
+		}
+		found = true
+	}
+	if found && budget <= 0 {
+		return time.Millisecond
+	}
+	return budget
+}
@@ -0,0 +1,119 @@
+package orchestrator
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+)
+
+func TestExpressionTimesOut(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	expr, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "(1+2)*(3+4)", Timeout: "100ms"}, "")
+	if err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+	// The same subexpression without a deadline keeps the shared task alive.
+	other, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "(1+2)*5"}, "")
+	if err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+
+	// 1+2 is shared with an expression that has no deadline, 3+4 is not.
+	for i := 0; i < 2; i++ {
+		task, ok := o.Store.GetPendingTask()
+		if !ok {
+			t.Fatal("GetPendingTask() returned no task")
+		}
+		switch task.ID {
+		case "task-expr-1-0":
+			if task.TimeoutMS != 0 {
+				t.Errorf("shared task timeout_ms = %d, want 0", task.TimeoutMS)
+			}
+		case "task-expr-1-1":
+			if task.TimeoutMS <= 0 || task.TimeoutMS > 100 {
+				t.Errorf("task timeout_ms = %d, want (0, 100]", task.TimeoutMS)
+			}
+		default:
+			t.Errorf("unexpected task %+v dispatched", task)
+		}
+	}
+
+	finished, err := o.Store.WaitExpression(context.Background(), expr.Id)
+	if err != nil {
+		t.Fatalf("WaitExpression unexpected error: %v", err)
+	}
+	if finished.Status != models.StatusTimedOut {
+		t.Fatalf("expression status = %s, want %s", finished.Status, models.StatusTimedOut)
+	}
+	if time.Since(*finished.Deadline) > time.Second {
+		t.Errorf("expression timed out %v after its deadline", time.Since(*finished.Deadline))
+	}
+
+	o.Store.Mu.Lock()
+	defer o.Store.Mu.Unlock()
+	for _, taskID := range o.Store.exprTasks[other.Id] {
+		if _, exists := o.Store.Tasks[taskID]; !exists {
+			t.Errorf("task %s of expression %d was dropped with the timed-out expression", taskID, other.Id)
+		}
+	}
+	if _, exists := o.Store.Tasks["task-expr-1-1"]; exists {
+		t.Errorf("task 3+4 of the timed-out expression is still stored")
+	}
+	if _, cancelled := o.Store.cancelledTasks["task-expr-1-1"]; !cancelled {
+		t.Errorf("task 3+4 of the timed-out expression is not marked as cancelled")
+	}
+}
+
+func TestTaskBudget(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	now := time.Now()
+	past, soon, later := now.Add(-time.Second), now.Add(time.Second), now.Add(time.Minute)
+	st.Expressions[1] = models.Expression{Id: 1, Deadline: &past}
+	st.Expressions[2] = models.Expression{Id: 2, Deadline: &past}
+	st.Expressions[3] = models.Expression{Id: 3, Deadline: &soon}
+	st.Expressions[4] = models.Expression{Id: 4, Deadline: &later}
+	st.Expressions[5] = models.Expression{Id: 5}
+
+	tests := []struct {
+		exprs []int
+		want  time.Duration
+	}{
+		{[]int{1, 2}, time.Millisecond},
+		{[]int{1, 3}, time.Second},
+		{[]int{3, 4}, time.Minute},
+		{[]int{4, 5}, 0},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		st.taskExprs["task"] = tt.exprs
+		if got := st.taskBudget("task", now); got != tt.want {
+			t.Errorf("taskBudget for expressions %v = %v, want %v", tt.exprs, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateValidatesDeadline(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	past := time.Now().Add(-time.Minute).Format(time.RFC3339)
+	future := time.Now().Add(time.Minute).Format(time.RFC3339)
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"expression": "1+1", "timeout": "soon"}`, http.StatusUnprocessableEntity},
+		{`{"expression": "1+1", "timeout": "-1s"}`, http.StatusUnprocessableEntity},
+		{`{"expression": "1+1", "deadline": "` + past + `"}`, http.StatusUnprocessableEntity},
+		{`{"expression": "1+1", "deadline": "` + future + `", "timeout": "1s"}`, http.StatusUnprocessableEntity},
+		{`{"expression": "1+1", "deadline": "` + future + `"}`, http.StatusCreated},
+		{`{"expression": "1+1", "timeout": "30s"}`, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		if rec := calculate(o, "/api/v1/calculate", tt.body); rec.Code != tt.want {
+			t.Errorf("calculate %s = %d, want %d", tt.body, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package orchestrator
+
+import "errors"
+
+var (
+	ErrExpressionNotFound = errors.New("expression not found")
+	ErrExpressionFinished = errors.New("expression already finished")
+	ErrDeliveryNotFound   = errors.New("delivery not found")
+	ErrWebhooksDisabled   = errors.New("callback_url requires WEBHOOK_SECRET to be configured")
+
+	ErrForbiddenCallbackTarget = errors.New("callback target address is not public")
+	ErrTaskNotFound            = errors.New("task not found")
+	ErrTaskCancelled           = errors.New("task cancelled")
+	ErrTaskCompleted           = errors.New("task already completed")
+	ErrTaskNotDispatched       = errors.New("task not dispatched to this agent")
+	ErrShuttingDown            = errors.New("orchestrator is shutting down")
+)
@@ -0,0 +1,107 @@
+package orchestrator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pAran0k/calc_go/models"
+)
+
+const (
+	EventTaskDispatched     = "task_dispatched"
+	EventTaskCompleted      = "task_completed"
+	EventTaskFailed         = "task_failed"
+	EventExpressionFinished = "expression_finished"
+)
+
+const subscriberBuffer = 64
+
+type Event struct {
+	Type         string             `json:"type"`
+	ExpressionID int                `json:"expression_id"`
+	TaskID       string             `json:"task_id,omitempty"`
+	Result       *float64           `json:"result,omitempty"`
+	Error        string             `json:"error,omitempty"`
+	Expression   *models.Expression `json:"expression,omitempty"`
+	Time         time.Time          `json:"time"`
+}
+
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[int]map[chan Event]struct{})}
+}
+
+func (h *Hub) Subscribe(exprID int) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	h.mu.Lock()
+	if h.subscribers[exprID] == nil {
+		h.subscribers[exprID] = make(map[chan Event]struct{})
+	}
+	h.subscribers[exprID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers[exprID], ch)
+		if len(h.subscribers[exprID]) == 0 {
+			delete(h.subscribers, exprID)
+		}
+	}
+}
+
+// Publish delivers event to the subscribers of its expression. A subscriber
+// that falls behind loses progress events, but never the terminal
+// expression_finished: the oldest buffered event makes room for it.
+func (h *Hub) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers[event.ExpressionID] {
+		select {
+		case ch <- event:
+			continue
+		default:
+		}
+		if event.Type != EventExpressionFinished {
+			continue
+		}
+		select {
+		case <-ch:
+		default:
+		}
+		// Only Publish sends, under h.mu, so the buffer has room now.
+		ch <- event
+	}
+}
+
+func (s *Store) WaitExpression(ctx context.Context, id int) (models.Expression, error) {
+	events, unsubscribe := s.Events.Subscribe(id)
+	defer unsubscribe()
+
+	expr, exists := s.GetExpression(id)
+	if !exists {
+		return expr, ErrExpressionNotFound
+	}
+	if expr.Status.IsFinal() {
+		return expr, nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return expr, ctx.Err()
+		case event := <-events:
+			if event.Type == EventExpressionFinished && event.Expression != nil {
+				return *event.Expression, nil
+			}
+		}
+	}
+}
@@ -2,44 +2,120 @@ package orchestrator
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/pAran0k/calc_go/env"
 	"github.com/pAran0k/calc_go/models"
 	calculations "github.com/pAran0k/calc_go/pkg/calc"
+	"github.com/pAran0k/calc_go/pkg/logging"
+	"github.com/pAran0k/calc_go/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Store struct {
-	Mu           sync.Mutex
-	Expressions  map[int]models.Expression
-	Tasks        map[string]models.Task
-	PendingTasks chan models.Task
+	Mu             sync.Mutex
+	Expressions    map[int]models.Expression
+	Tasks          map[string]models.Task
+	PendingTasks   []models.Task
+	Cache          *ResultCache
+	Events         *Hub
+	Metrics        *prometheus.Registry
+	metrics        *storeMetrics
+	exprTasks      map[int][]string
+	taskExprs      map[string][]int
+	inflight       map[string]string
+	cancelledTasks map[string]time.Time
+	finishedAt     map[int]time.Time
+	ttl            time.Duration
+	maxExpressions int
+	finishHooks    []func(models.Expression)
+	deleteHooks    []func(int)
+	taskTraces     map[string]*TaskTrace
+	exprTraces     map[int][]*TaskTrace
+	dispatched     map[string]taskLease
+	leaseTimeout   time.Duration
+	dispatchPaused bool
+	costs          models.OperationCosts
+	fair           *fairQueue
+	taskRank       map[string]int
+	agents         map[string]agentSeen
 }
 
-func NewStore() *Store {
-	return &Store{
-		Expressions:  make(map[int]models.Expression),
-		Tasks:        make(map[string]models.Task),
-		PendingTasks: make(chan models.Task, 100),
+func NewStore(config env.OrchestratorConfig) *Store {
+	st := &Store{
+		Expressions:    make(map[int]models.Expression),
+		Tasks:          make(map[string]models.Task),
+		Cache:          NewResultCache(config.ResultCacheSize),
+		Events:         NewHub(),
+		Metrics:        prometheus.NewRegistry(),
+		exprTasks:      make(map[int][]string),
+		taskExprs:      make(map[string][]int),
+		inflight:       make(map[string]string),
+		cancelledTasks: make(map[string]time.Time),
+		finishedAt:     make(map[int]time.Time),
+		taskTraces:     make(map[string]*TaskTrace),
+		exprTraces:     make(map[int][]*TaskTrace),
+		dispatched:     make(map[string]taskLease),
+		fair:           newFairQueue(),
+		taskRank:       make(map[string]int),
+		agents:         make(map[string]agentSeen),
+		ttl:            time.Duration(config.ExpressionTTLSec) * time.Second,
+		maxExpressions: config.MaxExpressions,
+		leaseTimeout:   time.Duration(config.TaskLeaseSec) * time.Second,
+		costs:          config.OperationCosts(),
 	}
+	st.metrics = newStoreMetrics(st.Metrics, st)
+	return st
 }
 
-func (s *Store) AddExpression(expr models.Expression) {
+// AddExpression stores expr. It returns false and keeps the stored
+// expression when that one has already reached a final status, e.g. because
+// it was cancelled while expr was being parsed.
+func (s *Store) AddExpression(expr models.Expression) bool {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
+	return s.storeExpression(expr)
+}
+
+func (s *Store) storeExpression(expr models.Expression) bool {
+	if stored, exists := s.Expressions[expr.Id]; exists && stored.Status.IsFinal() {
+		slog.Debug("finished expression not overwritten", logging.KeyExprID, expr.Id, "status", stored.Status)
+		return false
+	}
 	s.Expressions[expr.Id] = expr
-	log.Printf("Добавлено выражение %d: %+v", expr.Id, expr)
+	if expr.Status.IsFinal() {
+		s.markFinished(expr.Id)
+	}
+	slog.Debug("expression stored", logging.KeyExprID, expr.Id, "status", expr.Status)
+	return true
+}
+
+// StartExpression stores expr and queues its tasks under one lock, so a
+// cancellation cannot slip in between. It returns false and queues nothing
+// when the expression has already finished.
+func (s *Store) StartExpression(expr models.Expression, tasks []models.Task) (int, bool) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	if !s.storeExpression(expr) {
+		return 0, false
+	}
+	return s.addExpressionTasks(expr.Id, tasks), true
 }
 
 func (s *Store) GetExpression(id int) (models.Expression, bool) {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
 	expr, exists := s.Expressions[id]
-	log.Printf("Запрошено выражение %d: найдено=%v, %+v", id, exists, expr)
 	return expr, exists
 }
 
@@ -50,77 +126,333 @@ func (s *Store) GetAllExpressions() []models.Expression {
 	for _, expr := range s.Expressions {
 		expressions = append(expressions, expr)
 	}
-	log.Printf("Возвращено %d выражений", len(expressions))
 	return expressions
 }
 
-func (s *Store) AddTask(task models.Task) {
+func (s *Store) AddExpressionTasks(exprID int, tasks []models.Task) int {
 	s.Mu.Lock()
-	s.Tasks[task.ID] = task
-	log.Printf("Задача %s добавлена в Tasks: %+v, всего задач: %d", task.ID, task, len(s.Tasks))
-	s.PendingTasks <- task
-	s.Mu.Unlock()
+	defer s.Mu.Unlock()
+	return s.addExpressionTasks(exprID, tasks)
+}
+
+func (s *Store) addExpressionTasks(exprID int, tasks []models.Task) int {
+	if expr, exists := s.Expressions[exprID]; exists && expr.Status.IsFinal() {
+		return 0
+	}
+
+	ranks := rankTasks(tasks)
+	// Tasks come users first, so walking them in order reaches a subtree's
+	// root before its operands: once the root is cached or in flight, the
+	// tasks below it are never queued.
+	alias := make(map[string]string)
+	needed := make(map[string]bool)
+	operands := make(map[string]bool)
+	for _, task := range tasks {
+		operands[task.Arg1] = true
+		operands[task.Arg2] = true
+	}
+	for _, task := range tasks {
+		if !operands[task.ID] {
+			needed[task.ID] = true
+		}
+	}
+	for _, task := range tasks {
+		if !needed[task.ID] {
+			continue
+		}
+
+		if value, ok := s.Cache.Get(task.Hash); ok {
+			alias[task.ID] = strconv.FormatFloat(value, 'f', -1, 64)
+			slog.Debug("task result taken from cache", logging.KeyExprID, exprID, logging.KeyTaskID, task.ID, "value", value)
+			continue
+		}
+
+		if existingID, ok := s.inflight[task.Hash]; ok {
+			alias[task.ID] = existingID
+			s.linkTask(exprID, existingID)
+			s.taskRank[existingID] = max(s.taskRank[existingID], ranks[task.ID])
+			s.traceLinked(exprID, existingID)
+			slog.Debug("task merged with in-flight task", logging.KeyExprID, exprID, logging.KeyTaskID, task.ID, "inflight_task_id", existingID)
+			continue
+		}
+		needed[task.Arg1] = true
+		needed[task.Arg2] = true
+	}
+
+	scheduled := 0
+	for i := len(tasks) - 1; i >= 0; i-- {
+		task := tasks[i]
+		if _, resolved := alias[task.ID]; resolved || !needed[task.ID] {
+			continue
+		}
+		if replacement, ok := alias[task.Arg1]; ok {
+			task.Arg1 = replacement
+		}
+		if replacement, ok := alias[task.Arg2]; ok {
+			task.Arg2 = replacement
+		}
+
+		s.Tasks[task.ID] = task
+		if task.Hash != "" {
+			s.inflight[task.Hash] = task.ID
+		}
+		s.linkTask(exprID, task.ID)
+		s.taskRank[task.ID] = ranks[task.ID]
+		s.traceCreated(exprID, task)
+		s.PendingTasks = append(s.PendingTasks, task)
+		scheduled++
+		slog.Debug("task queued", logging.KeyExprID, exprID, logging.KeyTaskID, task.ID, "operation", task.Operation)
+	}
+
+	if len(s.exprTasks[exprID]) == 0 {
+		slog.Info("expression served entirely from cache", logging.KeyExprID, exprID)
+		s.finalizeExpression(exprID)
+	} else {
+		s.refreshRouting(exprID)
+	}
+	return scheduled
 }
 
-func (s *Store) UpdateTask(result models.Result) bool {
+func (s *Store) linkTask(exprID int, taskID string) {
+	task, exists := s.Tasks[taskID]
+	if !exists {
+		return
+	}
+	for _, id := range s.taskExprs[taskID] {
+		if id == exprID {
+			return
+		}
+	}
+	s.exprTasks[exprID] = append(s.exprTasks[exprID], taskID)
+	s.taskExprs[taskID] = append(s.taskExprs[taskID], exprID)
+	s.linkTask(exprID, task.Arg1)
+	s.linkTask(exprID, task.Arg2)
+}
+
+func (s *Store) CancelExpression(id int) (models.Expression, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	expr, exists := s.Expressions[id]
+	if !exists {
+		return expr, ErrExpressionNotFound
+	}
+	if expr.Status.IsFinal() {
+		return expr, ErrExpressionFinished
+	}
+
+	expr.Status = models.StatusCancelled
+	expr.Error = "expression cancelled"
+	s.Expressions[id] = expr
+	s.markFinished(id)
+	s.releaseExpressionTasks(id)
+	s.dropStalePendingTasks()
+
+	slog.Info("expression cancelled", logging.KeyExprID, id)
+	return expr, nil
+}
+
+func (s *Store) releaseExpressionTasks(id int) int {
+	released := 0
+	for _, taskID := range s.exprTasks[id] {
+		s.taskExprs[taskID] = removeExprID(s.taskExprs[taskID], id)
+		if len(s.taskExprs[taskID]) > 0 {
+			continue
+		}
+		task, exists := s.Tasks[taskID]
+		if !exists {
+			continue
+		}
+		if !task.Completed {
+			s.cancelledTasks[taskID] = time.Now()
+		}
+		if s.inflight[task.Hash] == taskID {
+			delete(s.inflight, task.Hash)
+		}
+		delete(s.taskExprs, taskID)
+		delete(s.taskRank, taskID)
+		delete(s.Tasks, taskID)
+		released++
+	}
+	delete(s.exprTasks, id)
+	return released
+}
+
+func (s *Store) dropStalePendingTasks() {
+	s.PendingTasks = slices.DeleteFunc(s.PendingTasks, func(task models.Task) bool {
+		_, exists := s.Tasks[task.ID]
+		return !exists
+	})
+}
+
+func (s *Store) IsTaskCancelled(taskID string) bool {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	_, cancelled := s.cancelledTasks[taskID]
+	return cancelled
+}
+
+func removeExprID(ids []int, id int) []int {
+	result := ids[:0]
+	for _, existing := range ids {
+		if existing != id {
+			result = append(result, existing)
+		}
+	}
+	return result
+}
+
+// UpdateTask records the result of a task dispatched to agentID. Like
+// ReleaseTask it only accepts the task's holder, and it rejects results for
+// completed or released tasks, so a stale agent cannot overwrite a value.
+func (s *Store) UpdateTask(result models.Result, agentID string) error {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
 
 	task, exists := s.Tasks[result.TaskID]
 	if !exists {
-		log.Printf("Ошибка: задача %s не найдена в Tasks: %+v", result.TaskID, s.Tasks)
-		return false
+		if _, cancelled := s.cancelledTasks[result.TaskID]; cancelled {
+			slog.Info("result for cancelled task discarded", logging.KeyTaskID, result.TaskID)
+			return ErrTaskCancelled
+		}
+		slog.Warn("result for unknown task", logging.KeyTaskID, result.TaskID)
+		return ErrTaskNotFound
+	}
+	if task.Completed {
+		return ErrTaskCompleted
 	}
+	if lease, running := s.dispatched[result.TaskID]; !running || lease.agent != agentID {
+		slog.Warn("result from an agent not holding the task", logging.KeyTaskID, result.TaskID, "agent", agentID)
+		return ErrTaskNotDispatched
+	}
+	delete(s.dispatched, result.TaskID)
 
-	log.Printf("Обновление задачи %s: старое значение %+v, новый результат %f", result.TaskID, task, result.Value)
+	s.traceCompleted(result)
+	if result.Attempts > 1 {
+		s.metrics.resultRetries.Add(float64(result.Attempts - 1))
+	}
+	if result.Error != "" {
+		s.metrics.tasksFailed.WithLabelValues(task.Operation).Inc()
+		slog.Warn("task failed", logging.KeyTaskID, result.TaskID, "error", result.Error)
+		for _, id := range append([]int(nil), s.taskExprs[task.ID]...) {
+			s.Events.Publish(Event{Type: EventTaskFailed, ExpressionID: id, TaskID: task.ID, Error: result.Error})
+			s.failExpression(id, result.Error)
+		}
+		return nil
+	}
+
+	s.metrics.tasksCompleted.WithLabelValues(task.Operation).Inc()
 	task.Result = result.Value
 	task.Completed = true
 	s.Tasks[result.TaskID] = task
-	log.Printf("Задача %s обновлена: %+v", result.TaskID, task)
+	slog.Debug("task completed", logging.KeyTaskID, result.TaskID, "value", result.Value, "attempts", result.Attempts)
 
-	parts := strings.Split(result.TaskID, "-")
-	if len(parts) < 3 {
-		log.Printf("Ошибка: неверный формат TaskID %s", result.TaskID)
-		return false
+	s.Cache.Add(task.Hash, task.Result)
+	if s.inflight[task.Hash] == task.ID {
+		delete(s.inflight, task.Hash)
 	}
-	exprIDStr := parts[2]
-	id, err := strconv.Atoi(exprIDStr)
-	if err != nil {
-		log.Printf("Ошибка разбора exprID из %s: %v", result.TaskID, err)
-		return false
+
+	for _, id := range s.taskExprs[task.ID] {
+		value := task.Result
+		s.Events.Publish(Event{Type: EventTaskCompleted, ExpressionID: id, TaskID: task.ID, Result: &value})
+		if !s.expressionTasksCompleted(id) {
+			continue
+		}
+		s.finalizeExpression(id)
 	}
 
-	expr, exists := s.Expressions[id]
+	return nil
+}
+
+// ReleaseTask puts a dispatched task back into the queue so another agent can
+// pick it up, e.g. when its agent is shutting down before finishing it. Only
+// the agent the task is dispatched to may release it, so a repeated or stale
+// release cannot queue the task twice.
+func (s *Store) ReleaseTask(taskID, agentID string) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	if _, cancelled := s.cancelledTasks[taskID]; cancelled {
+		return ErrTaskCancelled
+	}
+	task, exists := s.Tasks[taskID]
 	if !exists {
-		log.Printf("Выражение %d не найдено для задачи %s", id, result.TaskID)
-		return false
+		return ErrTaskNotFound
+	}
+	if task.Completed {
+		return ErrTaskCompleted
 	}
+	if lease, running := s.dispatched[taskID]; !running || lease.agent != agentID {
+		return ErrTaskNotDispatched
+	}
+
+	delete(s.dispatched, taskID)
+	s.traceReleased(taskID)
+	s.metrics.tasksReleased.WithLabelValues(task.Operation).Inc()
+	s.PendingTasks = append(s.PendingTasks, task)
+	slog.Info("task released back to queue", logging.KeyTaskID, taskID)
+	return nil
+}
 
-	allCompleted := true
-	for _, t := range s.Tasks {
-		if strings.Contains(t.ID, fmt.Sprintf("expr-%d", id)) && !t.Completed {
-			log.Printf("Задача %s для выражения %d ещё не завершена: %+v", t.ID, id, t)
-			allCompleted = false
-			break
+func (s *Store) expressionTasksCompleted(id int) bool {
+	for _, taskID := range s.exprTasks[id] {
+		if t, ok := s.Tasks[taskID]; ok && !t.Completed {
+			return false
 		}
 	}
+	return true
+}
 
-	if allCompleted {
-		log.Printf("Все задачи для выражения %d завершены, пересчитываем результат", id)
-		finalResult, err := s.calculateExpression(expr)
-		if err != nil {
-			expr.Status = 3
-			s.Expressions[id] = expr
-			log.Printf("Ошибка при вычислении выражения %d: %v", id, err)
-			return true
-		}
-		expr.Result = finalResult
-		expr.Status = 0
+func (s *Store) finalizeExpression(id int) {
+	expr, exists := s.Expressions[id]
+	if !exists {
+		return
+	}
+	if expr.Status != models.StatusProcessing {
+		return
+	}
+
+	finalResult, err := s.calculateExpression(expr)
+	if err != nil {
+		expr.Status = models.StatusFailed
+		expr.Error = err.Error()
 		s.Expressions[id] = expr
-		log.Printf("Выражение %d завершено: %+v", id, expr)
+		s.markFinished(id)
+		slog.Warn("expression evaluation failed", logging.KeyExprID, id, "error", err)
+		return
+	}
+	expr.Result = finalResult
+	expr.Status = models.StatusCompleted
+	s.Expressions[id] = expr
+	s.markFinished(id)
+	slog.Info("expression completed", logging.KeyExprID, id, "result", expr.Result)
+}
+
+func (s *Store) failExpression(id int, message string) {
+	expr, exists := s.Expressions[id]
+	if !exists || expr.Status.IsFinal() {
+		return
 	}
+	expr.Status = models.StatusFailed
+	expr.Error = message
+	s.Expressions[id] = expr
+	s.markFinished(id)
+	s.releaseExpressionTasks(id)
+	s.dropStalePendingTasks()
+	slog.Info("expression failed", logging.KeyExprID, id, "error", message)
+}
 
-	return true
+func (s *Store) markStarted(taskID string) {
+	now := time.Now()
+	for _, id := range s.taskExprs[taskID] {
+		s.Events.Publish(Event{Type: EventTaskDispatched, ExpressionID: id, TaskID: taskID, Time: now})
+		expr, exists := s.Expressions[id]
+		if !exists || expr.StartedAt != nil {
+			continue
+		}
+		expr.StartedAt = &now
+		s.Expressions[id] = expr
+	}
 }
 
 func (s *Store) calculateExpression(expr models.Expression) (float64, error) {
@@ -163,23 +495,51 @@ func (s *Store) evaluateNode(node *models.Node) (float64, error) {
 	}
 }
 
+// GetPendingTask hands out a task to an agent that runs every operation and
+// has no labels.
 func (s *Store) GetPendingTask() (models.Task, bool) {
+	return s.GetPendingTaskFor("", models.Capabilities{})
+}
+
+// GetPendingTaskFor hands out the next task the agent can run given its caps
+// and leases it to the agent. Tasks whose lease expired are queued again
+// first.
+func (s *Store) GetPendingTaskFor(agentID string, caps models.Capabilities) (models.Task, bool) {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
 
-	for i := 0; i < cap(s.PendingTasks); i++ {
-		select {
-		case task := <-s.PendingTasks:
-			if s.isTaskReady(task) {
-				log.Printf("Задача %s готова и выдана: %+v", task.ID, task)
-				return task, true
-			}
-			s.PendingTasks <- task
-		default:
-			return models.Task{}, false
+	if s.dispatchPaused {
+		return models.Task{}, false
+	}
+
+	now := time.Now()
+	s.expireLeases(now)
+	s.dropStalePendingTasks()
+	best := -1
+	var bestKey scheduleKey
+	for i, task := range s.PendingTasks {
+		if !caps.Accepts(task) || !s.isTaskReady(task) {
+			continue
 		}
+		if key := s.scheduleKey(task); best == -1 || key.before(bestKey) {
+			best, bestKey = i, key
+		}
+	}
+	if best == -1 {
+		return models.Task{}, false
 	}
-	return models.Task{}, false
+
+	task := s.PendingTasks[best]
+	s.PendingTasks = slices.Delete(s.PendingTasks, best, best+1)
+	s.fair.charge(bestKey.flow, bestKey.weight)
+	cost, _ := s.costs.For(task.Operation)
+	task.OperationTime = int(cost / time.Millisecond)
+	task.TimeoutMS = int(s.taskBudget(task.ID, now).Milliseconds())
+	s.markStarted(task.ID)
+	s.lease(task.ID, agentID, cost, now)
+	s.metrics.tasksDispatched.WithLabelValues(task.Operation).Inc()
+	slog.Debug("task dispatched", logging.KeyTaskID, task.ID, "operation", task.Operation, "operation_time", task.OperationTime, "flow", bestKey.flow)
+	return task, true
 }
 
 func (s *Store) isTaskReady(task models.Task) bool {
@@ -223,6 +583,51 @@ func HandleTask(st *Store) http.HandlerFunc {
 	}
 }
 
+func HandleTaskRelease(st *Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		taskID := strings.TrimPrefix(r.URL.Path, "/internal/task/release/")
+		if taskID == "" {
+			http.Error(w, "Missing task ID", http.StatusBadRequest)
+			return
+		}
+
+		_, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "orchestrator.release",
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("task.id", taskID),
+				attribute.String("agent.id", r.Header.Get(models.AgentIDHeader)),
+			))
+		defer span.End()
+
+		if err := st.ReleaseTask(taskID, r.Header.Get(models.AgentIDHeader)); err != nil {
+			writeTaskError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeTaskError answers an agent whose release or result the store refused.
+func writeTaskError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrTaskCancelled):
+		http.Error(w, "Task cancelled", http.StatusGone)
+	case errors.Is(err, ErrTaskNotFound):
+		http.Error(w, "Task not found", http.StatusNotFound)
+	case errors.Is(err, ErrTaskCompleted):
+		http.Error(w, "Task already completed", http.StatusConflict)
+	case errors.Is(err, ErrTaskNotDispatched):
+		http.Error(w, "Task not dispatched to this agent", http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func HandleTaskResult(st *Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -234,67 +639,99 @@ func HandleTaskResult(st *Store) http.HandlerFunc {
 }
 
 func handleGetTask(w http.ResponseWriter, r *http.Request, st *Store) {
-	task, exists := st.GetPendingTask()
+	caps, err := models.ParseCapabilities(r.Header.Get(models.AgentOperationsHeader), r.Header.Get(models.AgentLabelsHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	st.ObserveAgent(r.Header.Get(models.AgentIDHeader), caps)
+
+	task, exists := st.GetPendingTaskFor(r.Header.Get(models.AgentIDHeader), caps)
 	if !exists {
 		http.Error(w, "No task available", http.StatusNotFound)
 		return
 	}
-
+	st.RecordDispatch(task.ID, r.Header.Get(models.AgentIDHeader), r.Header.Get(models.AgentWorkerHeader))
+
+	ctx, span := tracing.Start(tracing.ExtractMap(r.Context(), task.Trace), "orchestrator.dispatch",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("task.id", task.ID),
+			attribute.String("task.operation", task.Operation),
+			attribute.String("agent.id", r.Header.Get(models.AgentIDHeader)),
+		))
+	defer span.End()
+	tracing.Inject(ctx, w.Header())
+
+	costs := st.OperationCosts()
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(struct {
-		Task models.Task `json:"task"`
-	}{Task: task})
+		Task           models.Task            `json:"task"`
+		OperationCosts *models.OperationCosts `json:"operation_costs,omitempty"`
+	}{Task: task, OperationCosts: &costs})
 }
 
 func handlePostTask(w http.ResponseWriter, r *http.Request, st *Store) {
+	_, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "orchestrator.taskResult", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
 	var result models.Result
 	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
-		log.Printf("Ошибка декодирования результата: %v", err)
+		slog.Warn("invalid task result payload", "error", err)
 		http.Error(w, "Invalid request", http.StatusUnprocessableEntity)
 		return
 	}
 
-	log.Printf("Получен результат для задачи %s: %f", result.TaskID, result.Value)
+	span.SetAttributes(attribute.String("task.id", result.TaskID))
+	st.TouchAgent(r.Header.Get(models.AgentIDHeader))
 	if result.TaskID == "" {
-		log.Println("Отсутствует TaskID в результате")
+		slog.Warn("task result without task id")
 		http.Error(w, "Missing task ID", http.StatusUnprocessableEntity)
 		return
 	}
 
-	if !st.UpdateTask(result) {
-		log.Printf("Задача %s не найдена при обновлении", result.TaskID)
-		http.Error(w, "Task not found", http.StatusNotFound)
+	if err := st.UpdateTask(result, r.Header.Get(models.AgentIDHeader)); err != nil {
+		writeTaskError(w, err)
 		return
 	}
 
-	log.Printf("Результат задачи %s успешно принят: %f", result.TaskID, result.Value)
 	w.WriteHeader(http.StatusOK)
 }
 
 func handleGetTaskResult(w http.ResponseWriter, r *http.Request, st *Store) {
 	taskID := strings.TrimPrefix(r.URL.Path, "/internal/task/result/")
 	if taskID == "" {
-		log.Println("Отсутствует taskID в запросе результата")
 		http.Error(w, "Missing task ID", http.StatusBadRequest)
 		return
 	}
 
+	_, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "orchestrator.dependencyResult",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("task.id", taskID)))
+	defer span.End()
+
+	st.TouchAgent(r.Header.Get(models.AgentIDHeader))
 	st.Mu.Lock()
 	defer st.Mu.Unlock()
 
+	if _, cancelled := st.cancelledTasks[taskID]; cancelled {
+		http.Error(w, "Task cancelled", http.StatusGone)
+		return
+	}
+
 	task, exists := st.Tasks[taskID]
 	if !exists {
-		log.Printf("Задача %s не найдена в Tasks", taskID)
+		slog.Debug("dependency result requested for unknown task", logging.KeyTaskID, taskID)
 		http.Error(w, "Task not found", http.StatusNotFound)
 		return
 	}
 
 	if !task.Completed {
-		log.Printf("Результат задачи %s ещё не готов: %+v", taskID, task)
 		http.Error(w, "Task result not available", http.StatusNotFound)
+		return
 	}
 
-	log.Printf("Возвращён результат задачи %s: %f", taskID, task.Result)
+	slog.Debug("dependency result served", logging.KeyTaskID, taskID)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(struct {
 		Result float64 `json:"result"`
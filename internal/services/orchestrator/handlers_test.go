@@ -0,0 +1,188 @@
+package orchestrator
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+)
+
+func TestCancelExpression(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	st.AddExpression(models.Expression{Id: 1, Status: models.StatusProcessing})
+	st.AddExpressionTasks(1, []models.Task{
+		{ID: "task-expr-1-0", Arg1: "task-expr-1-1", Arg2: "4", Operation: "+", Hash: "root"},
+		{ID: "task-expr-1-1", Arg1: "2", Arg2: "3", Operation: "*", Hash: "leaf"},
+	})
+
+	expr, err := st.CancelExpression(1)
+	if err != nil {
+		t.Fatalf("CancelExpression unexpected error: %v", err)
+	}
+	if expr.Status != models.StatusCancelled {
+		t.Errorf("cancelled expression status = %s, want %s", expr.Status, models.StatusCancelled)
+	}
+	if len(st.Tasks) != 0 || len(st.PendingTasks) != 0 {
+		t.Errorf("tasks were not purged: %d stored, %d pending", len(st.Tasks), len(st.PendingTasks))
+	}
+	if !st.IsTaskCancelled("task-expr-1-1") {
+		t.Errorf("task-expr-1-1 should be marked as cancelled")
+	}
+	if err := st.UpdateTask(models.Result{TaskID: "task-expr-1-1", Value: 6}, ""); !errors.Is(err, ErrTaskCancelled) {
+		t.Errorf("late result for cancelled task error = %v, want %v", err, ErrTaskCancelled)
+	}
+	if _, err := st.CancelExpression(1); !errors.Is(err, ErrExpressionFinished) {
+		t.Errorf("second cancel error = %v, want %v", err, ErrExpressionFinished)
+	}
+	if _, err := st.CancelExpression(2); !errors.Is(err, ErrExpressionNotFound) {
+		t.Errorf("missing expression error = %v, want %v", err, ErrExpressionNotFound)
+	}
+}
+
+func TestCancelKeepsSharedTasks(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	shared := models.Task{ID: "task-expr-1-0", Arg1: "2", Arg2: "3", Operation: "*", Hash: "shared"}
+	st.AddExpression(models.Expression{Id: 1, Status: models.StatusProcessing})
+	st.AddExpressionTasks(1, []models.Task{shared})
+	st.AddExpression(models.Expression{Id: 2, Status: models.StatusProcessing})
+	second := shared
+	second.ID = "task-expr-2-0"
+	st.AddExpressionTasks(2, []models.Task{second})
+
+	if _, err := st.CancelExpression(1); err != nil {
+		t.Fatalf("CancelExpression unexpected error: %v", err)
+	}
+	if _, exists := st.Tasks[shared.ID]; !exists {
+		t.Fatalf("task shared with expression 2 should be kept")
+	}
+	if task, ok := st.GetPendingTask(); !ok || task.ID != shared.ID {
+		t.Errorf("GetPendingTask() = %+v, %v, want shared task", task, ok)
+	}
+}
+
+func TestCancelBeforeStartWins(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	st.AddExpression(models.Expression{Id: 1, Status: models.StatusPending})
+	if _, err := st.CancelExpression(1); err != nil {
+		t.Fatalf("CancelExpression unexpected error: %v", err)
+	}
+
+	processing := models.Expression{Id: 1, Status: models.StatusProcessing}
+	if _, started := st.StartExpression(processing, []models.Task{{ID: "task-expr-1-0", Arg1: "2", Arg2: "3", Operation: "+"}}); started {
+		t.Error("StartExpression started a cancelled expression")
+	}
+	if st.AddExpression(processing) {
+		t.Error("AddExpression overwrote a cancelled expression")
+	}
+	if expr, _ := st.GetExpression(1); expr.Status != models.StatusCancelled {
+		t.Errorf("status = %s, want %s", expr.Status, models.StatusCancelled)
+	}
+	if len(st.Tasks) != 0 || len(st.PendingTasks) != 0 {
+		t.Errorf("cancelled expression scheduled %d tasks", len(st.Tasks))
+	}
+}
+
+func TestTaskErrorFailsExpression(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	st.AddExpression(models.Expression{Id: 1, Status: models.StatusProcessing})
+	st.AddExpressionTasks(1, []models.Task{
+		{ID: "task-expr-1-0", Arg1: "task-expr-1-1", Arg2: "0", Operation: "/", Hash: "root"},
+		{ID: "task-expr-1-1", Arg1: "2", Arg2: "3", Operation: "-", Hash: "leaf"},
+	})
+
+	if _, ok := st.GetPendingTask(); !ok {
+		t.Fatalf("leaf task should be ready")
+	}
+	if expr, _ := st.GetExpression(1); expr.StartedAt == nil {
+		t.Errorf("StartedAt should be set on first dispatch")
+	}
+
+	st.UpdateTask(models.Result{TaskID: "task-expr-1-1", Value: -1}, "")
+	if _, ok := st.GetPendingTask(); !ok {
+		t.Fatalf("root task should be ready")
+	}
+	st.UpdateTask(models.Result{TaskID: "task-expr-1-0", Error: "division by zero"}, "")
+
+	expr, _ := st.GetExpression(1)
+	if expr.Status != models.StatusFailed || expr.Error != "division by zero" || expr.FinishedAt == nil {
+		t.Errorf("expression = %+v, want failed with error message", expr)
+	}
+}
+
+func TestReleaseTaskRequeues(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	st.AddExpression(models.Expression{Id: 1, Status: models.StatusProcessing})
+	st.AddExpressionTasks(1, []models.Task{{ID: "task-expr-1-0", Arg1: "2", Arg2: "3", Operation: "+", Hash: "sum"}})
+
+	task, ok := st.GetPendingTaskFor("agent-1", models.Capabilities{})
+	if !ok {
+		t.Fatal("GetPendingTaskFor() returned no task")
+	}
+	if _, ok := st.GetPendingTask(); ok {
+		t.Fatal("dispatched task should not be handed out twice")
+	}
+
+	if err := st.ReleaseTask(task.ID, "agent-2"); !errors.Is(err, ErrTaskNotDispatched) {
+		t.Errorf("release by another agent error = %v, want %v", err, ErrTaskNotDispatched)
+	}
+	if err := st.ReleaseTask(task.ID, "agent-1"); err != nil {
+		t.Fatalf("ReleaseTask unexpected error: %v", err)
+	}
+	if err := st.ReleaseTask(task.ID, "agent-1"); !errors.Is(err, ErrTaskNotDispatched) {
+		t.Errorf("repeated release error = %v, want %v", err, ErrTaskNotDispatched)
+	}
+	if again, ok := st.GetPendingTask(); !ok || again.ID != task.ID {
+		t.Errorf("GetPendingTask() after release = %+v, %v, want %s", again, ok, task.ID)
+	}
+	if _, ok := st.GetPendingTask(); ok {
+		t.Error("released task was queued more than once")
+	}
+
+	st.UpdateTask(models.Result{TaskID: task.ID, Value: 5}, "")
+	if err := st.ReleaseTask(task.ID, ""); !errors.Is(err, ErrTaskCompleted) {
+		t.Errorf("release of completed task error = %v, want %v", err, ErrTaskCompleted)
+	}
+	if err := st.ReleaseTask("task-expr-9-0", ""); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("release of unknown task error = %v, want %v", err, ErrTaskNotFound)
+	}
+}
+
+func TestUpdateTaskRequiresHolder(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	node := &models.Node{Value: "+", Left: &models.Node{Value: "2"}, Right: &models.Node{Value: "3"}}
+	st.AddExpression(models.Expression{Id: 1, Status: models.StatusProcessing, Node: node})
+	st.AddExpressionTasks(1, []models.Task{{ID: "task-expr-1-0", Arg1: "2", Arg2: "3", Operation: "+", Hash: "sum"}})
+
+	task, _ := st.GetPendingTaskFor("agent-1", models.Capabilities{})
+	if err := st.UpdateTask(models.Result{TaskID: task.ID, Value: 100}, "agent-2"); !errors.Is(err, ErrTaskNotDispatched) {
+		t.Errorf("result from another agent error = %v, want %v", err, ErrTaskNotDispatched)
+	}
+
+	// Once released and handed to agent-2, the task no longer takes agent-1's result.
+	st.ReleaseTask(task.ID, "agent-1")
+	st.GetPendingTaskFor("agent-2", models.Capabilities{})
+	if err := st.UpdateTask(models.Result{TaskID: task.ID, Value: 100}, "agent-1"); !errors.Is(err, ErrTaskNotDispatched) {
+		t.Errorf("result from the previous holder error = %v, want %v", err, ErrTaskNotDispatched)
+	}
+	if err := st.UpdateTask(models.Result{TaskID: task.ID, Value: 5}, "agent-2"); err != nil {
+		t.Fatalf("UpdateTask unexpected error: %v", err)
+	}
+	if err := st.UpdateTask(models.Result{TaskID: task.ID, Value: 100}, "agent-2"); !errors.Is(err, ErrTaskCompleted) {
+		t.Errorf("second result error = %v, want %v", err, ErrTaskCompleted)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/internal/task", strings.NewReader(`{"task_id": "task-expr-1-0", "value": 100}`))
+	req.Header.Set(models.AgentIDHeader, "agent-2")
+	rec := httptest.NewRecorder()
+	handlePostTask(rec, req, st)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("repeated result = %d, want 409", rec.Code)
+	}
+	if expr, _ := st.GetExpression(1); expr.Status != models.StatusCompleted || expr.Result != 5 {
+		t.Errorf("expression = %s %v, want completed with 5", expr.Status, expr.Result)
+	}
+}
@@ -0,0 +1,91 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pAran0k/calc_go/pkg/health"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+type BacklogStats struct {
+	Queued            int
+	ActiveExpressions int
+}
+
+func (o *Orchestrator) livenessChecks() []health.Check {
+	return []health.Check{{Name: "store", Run: o.checkStore}}
+}
+
+func (o *Orchestrator) readinessChecks() []health.Check {
+	checks := []health.Check{
+		{Name: "store", Run: o.checkStore},
+		{Name: "backlog", Run: o.checkBacklog},
+		{Name: "shutdown", Run: o.checkShutdown},
+	}
+	if o.Elector != nil {
+		checks = append(checks, health.Check{Name: "leadership", Run: o.checkLeadership})
+	}
+	return checks
+}
+
+func (o *Orchestrator) checkStore(ctx context.Context) (string, error) {
+	if !o.Store.lockWithin(ctx) {
+		return "", fmt.Errorf("store lock not acquired within %s", healthCheckTimeout)
+	}
+	expressions, tasks := len(o.Store.Expressions), len(o.Store.Tasks)
+	o.Store.Mu.Unlock()
+	return fmt.Sprintf("%d expressions, %d tasks", expressions, tasks), nil
+}
+
+func (o *Orchestrator) checkShutdown(context.Context) (string, error) {
+	if o.shuttingDown.Load() {
+		return "", ErrShuttingDown
+	}
+	return "", nil
+}
+
+func (o *Orchestrator) checkBacklog(ctx context.Context) (string, error) {
+	stats, ok := o.Store.Backlog(ctx)
+	if !ok {
+		return "", fmt.Errorf("store lock not acquired within %s", healthCheckTimeout)
+	}
+	detail := fmt.Sprintf("%d tasks queued, %d active expressions", stats.Queued, stats.ActiveExpressions)
+	if o.ReadyMaxQueuedTasks > 0 && stats.Queued >= o.ReadyMaxQueuedTasks {
+		return detail, fmt.Errorf("%d tasks queued, limit %d", stats.Queued, o.ReadyMaxQueuedTasks)
+	}
+	if o.ReadyMaxActiveExpressions > 0 && stats.ActiveExpressions >= o.ReadyMaxActiveExpressions {
+		return detail, fmt.Errorf("%d active expressions, limit %d", stats.ActiveExpressions, o.ReadyMaxActiveExpressions)
+	}
+	return detail, nil
+}
+
+// Backlog reports the number of queued tasks and the number of unfinished expressions.
+// ok is false when the store stays locked until ctx is done.
+func (s *Store) Backlog(ctx context.Context) (stats BacklogStats, ok bool) {
+	if !s.lockWithin(ctx) {
+		return stats, false
+	}
+	defer s.Mu.Unlock()
+
+	stats.Queued = len(s.PendingTasks)
+	for _, expr := range s.Expressions {
+		if !expr.Status.IsFinal() {
+			stats.ActiveExpressions++
+		}
+	}
+	return stats, true
+}
+
+func (s *Store) lockWithin(ctx context.Context) bool {
+	for !s.Mu.TryLock() {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+	"github.com/pAran0k/calc_go/pkg/health"
+)
+
+func probe(t *testing.T, o *Orchestrator, path string) (int, health.Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	o.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var report health.Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("decode %s: %v", path, err)
+	}
+	return rec.Code, report
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	o := NewOrchestrator(env.DefaultOrchestratorConfig())
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		code, report := probe(t, o, path)
+		if code != http.StatusOK || report.Status != health.StatusOK {
+			t.Errorf("%s = %d %+v, want 200 ok", path, code, report)
+		}
+		if report.Checks["store"].Status != health.StatusOK {
+			t.Errorf("%s store check = %+v, want ok", path, report.Checks["store"])
+		}
+	}
+}
+
+func TestReadinessFailsOnBacklog(t *testing.T) {
+	o := NewOrchestrator(env.DefaultOrchestratorConfig())
+	o.ReadyMaxQueuedTasks = 50
+	for i := 0; i < 50; i++ {
+		o.Store.PendingTasks = append(o.Store.PendingTasks, models.Task{})
+	}
+
+	code, report := probe(t, o, "/readyz")
+	if code != http.StatusServiceUnavailable || report.Checks["backlog"].Status != health.StatusFail {
+		t.Errorf("/readyz = %d %+v, want 503 with failing backlog", code, report)
+	}
+
+	code, _ = probe(t, o, "/healthz")
+	if code != http.StatusOK {
+		t.Errorf("/healthz = %d, want 200 while only the backlog is full", code)
+	}
+}
+
+func TestReadinessSurvivesLargeExpression(t *testing.T) {
+	o := NewOrchestrator(env.DefaultOrchestratorConfig())
+	expression := "1" + strings.Repeat("+1", 150)
+	if _, err := o.submitExpression(context.Background(), CalculateRequest{Expression: expression}, ""); err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+
+	if queued := len(o.Store.PendingTasks); queued < 100 {
+		t.Fatalf("queued tasks = %d, want the expression to fill the queue", queued)
+	}
+
+	code, report := probe(t, o, "/readyz")
+	if code != http.StatusOK {
+		t.Errorf("/readyz = %d %+v, want 200 after one large expression", code, report)
+	}
+}
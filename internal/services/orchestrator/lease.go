@@ -0,0 +1,52 @@
+package orchestrator
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/pAran0k/calc_go/pkg/logging"
+)
+
+// taskLease records which agent holds a dispatched task and until when. An
+// agent that crashes stops renewing its leases, and their tasks go back to
+// the queue once they expire instead of staying in flight forever.
+type taskLease struct {
+	agent   string
+	expires time.Time
+}
+
+// lease hands taskID to agentID for the task's operation time plus the lease
+// timeout. Callers hold s.Mu.
+func (s *Store) lease(taskID, agentID string, cost time.Duration, now time.Time) {
+	s.dispatched[taskID] = taskLease{agent: agentID, expires: now.Add(cost + s.leaseTimeout)}
+}
+
+// renewLeases extends the leases an agent holds: every request it makes
+// shows it is still working on them. Callers hold s.Mu.
+func (s *Store) renewLeases(agentID string, now time.Time) {
+	for taskID, lease := range s.dispatched {
+		if lease.agent == agentID && lease.expires.Before(now.Add(s.leaseTimeout)) {
+			lease.expires = now.Add(s.leaseTimeout)
+			s.dispatched[taskID] = lease
+		}
+	}
+}
+
+// expireLeases queues again the unfinished tasks whose lease ran out.
+// Callers hold s.Mu.
+func (s *Store) expireLeases(now time.Time) {
+	for taskID, lease := range s.dispatched {
+		if !now.After(lease.expires) {
+			continue
+		}
+		delete(s.dispatched, taskID)
+		task, exists := s.Tasks[taskID]
+		if !exists || task.Completed {
+			continue
+		}
+		s.traceReleased(taskID)
+		s.metrics.tasksReleased.WithLabelValues(task.Operation).Inc()
+		s.PendingTasks = append(s.PendingTasks, task)
+		slog.Warn("task lease expired", logging.KeyTaskID, taskID, "agent", lease.agent)
+	}
+}
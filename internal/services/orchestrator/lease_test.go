@@ -0,0 +1,45 @@
+package orchestrator
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+)
+
+func TestExpiredLeaseRequeuesTask(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	st.SetOperationCosts(models.OperationCosts{})
+	st.leaseTimeout = 50 * time.Millisecond
+	st.AddExpression(models.Expression{Id: 1, Status: models.StatusProcessing})
+	st.AddExpressionTasks(1, []models.Task{{ID: "task-expr-1-0", Arg1: "2", Arg2: "3", Operation: "+", Hash: "sum"}})
+
+	task, ok := st.GetPendingTaskFor("agent-1", models.Capabilities{})
+	if !ok {
+		t.Fatal("GetPendingTaskFor() returned no task")
+	}
+
+	// Requests from the holder renew its lease.
+	for i := 0; i < 3; i++ {
+		time.Sleep(30 * time.Millisecond)
+		st.TouchAgent("agent-1")
+		if _, ok := st.GetPendingTaskFor("agent-2", models.Capabilities{}); ok {
+			t.Fatal("task handed out again while its holder reports in")
+		}
+	}
+
+	// A silent holder loses the task to the next agent that polls.
+	time.Sleep(80 * time.Millisecond)
+	again, ok := st.GetPendingTaskFor("agent-2", models.Capabilities{})
+	if !ok || again.ID != task.ID {
+		t.Fatalf("GetPendingTaskFor() after expiry = %+v, %v, want %s", again, ok, task.ID)
+	}
+	if n := st.InFlightTasks(); n != 1 {
+		t.Errorf("InFlightTasks() = %d, want 1", n)
+	}
+	if err := st.UpdateTask(models.Result{TaskID: task.ID, Value: 5}, "agent-1"); !errors.Is(err, ErrTaskNotDispatched) {
+		t.Errorf("result from the expired holder error = %v, want %v", err, ErrTaskNotDispatched)
+	}
+}
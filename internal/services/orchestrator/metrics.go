@@ -0,0 +1,95 @@
+package orchestrator
+
+import (
+	"github.com/pAran0k/calc_go/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type storeMetrics struct {
+	tasksDispatched   *prometheus.CounterVec
+	tasksCompleted    *prometheus.CounterVec
+	tasksFailed       *prometheus.CounterVec
+	tasksReleased     *prometheus.CounterVec
+	resultRetries     prometheus.Counter
+	expressionLatency *prometheus.HistogramVec
+}
+
+func newStoreMetrics(registry *prometheus.Registry, s *Store) *storeMetrics {
+	m := &storeMetrics{
+		tasksDispatched: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "calc_tasks_dispatched_total",
+			Help: "Tasks handed out to agents.",
+		}, []string{"operation"}),
+		tasksCompleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "calc_tasks_completed_total",
+			Help: "Tasks completed by agents.",
+		}, []string{"operation"}),
+		tasksFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "calc_tasks_failed_total",
+			Help: "Tasks reported as failed by agents.",
+		}, []string{"operation"}),
+		tasksReleased: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "calc_tasks_released_total",
+			Help: "Dispatched tasks handed back by draining agents.",
+		}, []string{"operation"}),
+		resultRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "calc_result_submission_retries_total",
+			Help: "Extra attempts agents needed to submit results.",
+		}),
+		expressionLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "calc_expression_duration_seconds",
+			Help:    "Time from submission to completion of an expression.",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"status"}),
+	}
+	registry.MustRegister(
+		m.tasksDispatched, m.tasksCompleted, m.tasksFailed, m.tasksReleased,
+		m.resultRetries, m.expressionLatency, newQueueCollector(s),
+	)
+	return m
+}
+
+// queueCollector reports the dispatch queue from a single QueueStats call
+// per scrape, so both gauges describe the same moment.
+type queueCollector struct {
+	store  *Store
+	queued *prometheus.Desc
+	ready  *prometheus.Desc
+}
+
+func newQueueCollector(s *Store) *queueCollector {
+	return &queueCollector{
+		store:  s,
+		queued: prometheus.NewDesc("calc_queue_tasks", "Tasks waiting in the dispatch queue.", nil, nil),
+		ready:  prometheus.NewDesc("calc_queue_ready_tasks", "Queued tasks whose dependencies are completed.", nil, nil),
+	}
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queued
+	ch <- c.ready
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	queued, ready := c.store.QueueStats()
+	ch <- prometheus.MustNewConstMetric(c.queued, prometheus.GaugeValue, float64(queued))
+	ch <- prometheus.MustNewConstMetric(c.ready, prometheus.GaugeValue, float64(ready))
+}
+
+func (s *Store) QueueStats() (queued, ready int) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	for _, task := range s.PendingTasks {
+		if s.isTaskReady(task) {
+			ready++
+		}
+	}
+	return len(s.PendingTasks), ready
+}
+
+func (m *storeMetrics) observeExpression(expr models.Expression) {
+	if expr.CreatedAt.IsZero() || expr.FinishedAt == nil {
+		return
+	}
+	m.expressionLatency.WithLabelValues(expr.Status.String()).Observe(expr.FinishedAt.Sub(expr.CreatedAt).Seconds())
+}
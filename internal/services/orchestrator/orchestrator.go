@@ -3,56 +3,143 @@ package orchestrator
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/pAran0k/calc_go/env"
 	"github.com/pAran0k/calc_go/models"
 	calculations "github.com/pAran0k/calc_go/pkg/calc"
+	"github.com/pAran0k/calc_go/pkg/election"
+	"github.com/pAran0k/calc_go/pkg/health"
+	"github.com/pAran0k/calc_go/pkg/logging"
+	"github.com/pAran0k/calc_go/pkg/metrics"
+	"github.com/pAran0k/calc_go/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Orchestrator struct {
-	Addr        string
-	Server      *http.Server
-	Store       *Store
-	taskCounter uint64
+	Addr                      string
+	Server                    *http.Server
+	Store                     *Store
+	GCInterval                time.Duration
+	Webhooks                  *Notifier
+	ReadyMaxQueuedTasks       int
+	ReadyMaxActiveExpressions int
+	ShutdownTimeout           time.Duration
+	ShutdownWaitTasks         bool
+	SnapshotPath              string
+	Elector                   *election.Elector
+	AllowedOrigins            []string
+	requests                  *prometheus.CounterVec
+	taskCounter               uint64
+	shuttingDown              atomic.Bool
+	leading                   atomic.Bool
+	replicaMu                 sync.Mutex
+	syncInterval              time.Duration
+	sharedMu                  sync.Mutex
+	writeRequests             atomic.Uint64
+	written                   uint64
 }
 
-func NewOrchestrator(addr string) *Orchestrator {
-	st := NewStore()
-	return &Orchestrator{
-		Addr:  addr,
-		Store: st,
+func NewOrchestrator(config env.OrchestratorConfig) *Orchestrator {
+	st := NewStore(config)
+	webhooks := NewNotifier(config.WebhookSecret, config.WebhookMaxAttempts, time.Duration(config.WebhookBackoffMS)*time.Millisecond)
+	webhooks.AllowPrivateTargets = config.WebhookAllowPrivateTargets
+	st.OnExpressionFinished(webhooks.Notify)
+	st.OnExpressionDeleted(webhooks.Forget)
+	o := &Orchestrator{
+		Addr:                      config.OrchestratorAddr,
+		Store:                     st,
+		GCInterval:                time.Duration(config.GCIntervalSec) * time.Second,
+		Webhooks:                  webhooks,
+		ReadyMaxQueuedTasks:       config.ReadyMaxQueuedTasks,
+		ReadyMaxActiveExpressions: config.ReadyMaxActiveExpressions,
+		ShutdownTimeout:           time.Duration(config.ShutdownTimeoutSec) * time.Second,
+		ShutdownWaitTasks:         config.ShutdownWaitTasks,
+		SnapshotPath:              config.SnapshotPath,
+		Elector:                   newElector(config),
+		AllowedOrigins:            config.AllowedOrigins(),
+		syncInterval:              replicaSyncInterval,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "calc_http_requests_total",
+			Help: "HTTP requests by route and status code.",
+		}, []string{"route", "code"}),
 		Server: &http.Server{
-			Addr:    addr,
+			Addr:    config.OrchestratorAddr,
 			Handler: nil,
 		},
 	}
+	leader := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "calc_orchestrator_leader",
+		Help: "1 while this replica holds leadership.",
+	}, func() float64 {
+		if o.IsLeader() {
+			return 1
+		}
+		return 0
+	})
+	st.Metrics.MustRegister(o.requests, leader)
+	if o.SnapshotPath != "" {
+		o.restoreSnapshot()
+	}
+	return o
 }
 
-func (o *Orchestrator) Run(ctx context.Context) error {
+func (o *Orchestrator) Handler() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/api/v1/calculate", o.handleCalculate)
-	mux.HandleFunc("/api/v1/expressions", o.handleGetExpressions)
-	mux.HandleFunc("/api/v1/expressions/", o.handleGetExpressionByID)
-	mux.HandleFunc("/internal/task", HandleTask(o.Store))
-	mux.HandleFunc("/internal/task/result/", HandleTaskResult(o.Store))
+	for _, prefix := range []string{"/api/v1", "/api/v2"} {
+		mux.HandleFunc(prefix+"/calculate", o.onLeader(o.handleCalculate))
+		mux.HandleFunc(prefix+"/expressions", o.onLeader(o.handleGetExpressions))
+		mux.HandleFunc(prefix+"/expressions/", o.onLeader(o.handleExpressionByID))
+		mux.HandleFunc(prefix+"/ws", o.onLeader(o.handleWebSocket))
+	}
+	mux.HandleFunc("/api/v1/admin/purge", o.onLeader(o.handlePurge))
+	mux.HandleFunc("/api/v1/admin/operation-costs", o.onLeader(o.handleOperationCosts))
+	mux.HandleFunc("/api/v1/admin/webhooks/dead-letters", o.onLeader(o.handleDeadLetters))
+	mux.HandleFunc("/api/v1/admin/webhooks/dead-letters/", o.onLeader(o.handleReplayDeadLetter))
+	mux.HandleFunc("/internal/task", o.onLeader(HandleTask(o.Store)))
+	mux.HandleFunc("/internal/task/result/", o.onLeader(HandleTaskResult(o.Store)))
+	mux.HandleFunc("/internal/task/release/", o.onLeader(HandleTaskRelease(o.Store)))
+	mux.Handle("/metrics", metrics.Handler(o.Store.Metrics))
+	mux.Handle("/healthz", health.Handler(healthCheckTimeout, o.livenessChecks()...))
+	mux.Handle("/readyz", health.Handler(healthCheckTimeout, o.readinessChecks()...))
+	return metrics.InstrumentHandler(mux, o.requests)
+}
 
-	o.Server.Handler = mux
+func (o *Orchestrator) Run(ctx context.Context) error {
+	o.Server.Handler = o.Handler()
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	o.Server.BaseContext = func(net.Listener) context.Context { return requestCtx }
+
+	if o.Elector == nil {
+		go o.Store.RunJanitor(ctx, o.GCInterval)
+	} else {
+		// Leadership is kept through shutdown so that the leader writes the
+		// final snapshot before another replica takes over.
+		electionCtx, stopElection := context.WithCancel(context.Background())
+		defer stopElection()
+		go o.campaign(electionCtx)
+	}
 
 	go func() {
 		if err := o.Server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("Ошибка сервера: %v", err)
+			slog.Error("orchestrator server failed", "error", err)
 		}
 	}()
 
 	<-ctx.Done()
-	log.Println("Останавливаем оркестратор")
-	return o.Server.Shutdown(context.Background())
+	return o.shutdown(cancelRequests)
 }
 
 func (o *Orchestrator) handleCalculate(w http.ResponseWriter, r *http.Request) {
@@ -61,74 +148,195 @@ func (o *Orchestrator) handleCalculate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Expression string `json:"expression"`
+	var wait time.Duration
+	if v := r.URL.Query().Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			http.Error(w, "Invalid wait duration", http.StatusBadRequest)
+			return
+		}
+		wait = min(d, maxSyncWait)
 	}
+
+	var req CalculateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Expression == "" {
 		http.Error(w, "Invalid request", http.StatusUnprocessableEntity)
 		return
 	}
 
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "orchestrator.calculate", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	expr, err := o.submitExpression(ctx, req, r.Header.Get("X-User-ID"))
+	span.SetAttributes(attribute.Int("expression.id", expr.Id))
+	if errors.Is(err, ErrShuttingDown) {
+		tracing.RecordError(span, err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		tracing.RecordError(span, err)
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if wait > 0 {
+		o.waitAndRespond(w, r, expr, wait)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		ID         int `json:"id"`
+		TasksSaved int `json:"tasks_saved,omitempty"`
+	}{ID: expr.Id, TasksSaved: expr.TasksSaved})
+}
+
+const maxSyncWait = time.Minute
+
+func (o *Orchestrator) waitAndRespond(w http.ResponseWriter, r *http.Request, expr models.Expression, wait time.Duration) {
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+
+	finished, err := o.Store.WaitExpression(ctx, expr.Id)
+	if r.Context().Err() != nil {
+		slog.Debug("client disconnected before expression finished", logging.KeyExprID, expr.Id)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(struct {
+			ID int `json:"id"`
+		}{ID: expr.Id})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		ID         int `json:"id"`
+		Expression any `json:"expression"`
+	}{ID: expr.Id, Expression: presentExpression(finished, apiVersion(r))})
+}
+
+type CalculateRequest struct {
+	Expression  string                        `json:"expression"`
+	Optimize    *calculations.OptimizeOptions `json:"optimize,omitempty"`
+	Rebalance   bool                          `json:"rebalance,omitempty"`
+	CallbackURL string                        `json:"callback_url,omitempty"`
+	Priority    string                        `json:"priority,omitempty"`
+	Deadline    *time.Time                    `json:"deadline,omitempty"`
+	Timeout     string                        `json:"timeout,omitempty"`
+	Labels      []string                      `json:"labels,omitempty"`
+}
+
+func (o *Orchestrator) submitExpression(ctx context.Context, req CalculateRequest, owner string) (models.Expression, error) {
+	if o.shuttingDown.Load() {
+		return models.Expression{}, ErrShuttingDown
+	}
+	if req.CallbackURL != "" {
+		// Without a key the signature would authenticate nothing.
+		if o.Webhooks == nil || len(o.Webhooks.Secret) == 0 {
+			return models.Expression{}, ErrWebhooksDisabled
+		}
+		if err := ValidateCallbackURL(req.CallbackURL); err != nil {
+			return models.Expression{}, err
+		}
+	}
+	priority, err := models.ParsePriority(req.Priority)
+	if err != nil {
+		return models.Expression{}, err
+	}
+	now := time.Now()
+	deadline, err := requestDeadline(req, now)
+	if err != nil {
+		return models.Expression{}, err
+	}
+	labels, err := models.ParseLabels(req.Labels)
+	if err != nil {
+		return models.Expression{}, err
+	}
+
 	id := int(atomic.AddUint64(&o.taskCounter, 1))
 	expr := models.Expression{
-		Name:   req.Expression,
-		Status: 2,
-		Id:     id,
+		Name:        req.Expression,
+		Id:          id,
+		Owner:       owner,
+		Priority:    priority,
+		CallbackURL: req.CallbackURL,
+		CreatedAt:   now,
+		Deadline:    deadline,
+		Labels:      labels,
 	}
 
-	o.Store.AddExpression(expr)
-	log.Printf("Выражение %d со статусом 2 добавлено в Store: %+v", id, expr)
-
+	// Nothing is stored until the expression is known to be valid, so a
+	// rejected request leaves no failed expression behind and fires no
+	// webhook.
 	rpn, err := calculations.ToRPN(req.Expression)
 	if err != nil {
-		expr.Status = 3
-		o.Store.AddExpression(expr)
-		http.Error(w, "Invalid expression: "+err.Error(), http.StatusUnprocessableEntity)
-		return
+		return models.Expression{}, fmt.Errorf("invalid expression: %w", err)
 	}
 
 	tree, err := calculations.ParseRPN(rpn)
 	if err != nil {
-		expr.Status = 3
-		o.Store.AddExpression(expr)
-		http.Error(w, "Failed to parse expression", http.StatusUnprocessableEntity)
-		return
+		return models.Expression{}, fmt.Errorf("failed to parse expression: %w", err)
+	}
+
+	if req.Optimize != nil {
+		tree, expr.TasksSaved = calculations.Optimize(tree, *req.Optimize)
+		slog.Debug("expression optimized", logging.KeyExprID, id, "tasks_saved", expr.TasksSaved)
+	}
+
+	if req.Rebalance {
+		tree = calculations.Rebalance(tree)
 	}
 
 	expr.Node = tree
-	tasks, err := calculations.BuildTasks(fmt.Sprintf("expr-%d", id), tree)
+	expr.CriticalPath = calculations.CriticalPathDepth(tree)
+	tasks, err := o.buildTasks(ctx, id, tree)
 	if err != nil {
-		expr.Status = 3
-		o.Store.AddExpression(expr)
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
-		return
+		return models.Expression{}, err
 	}
+	labelTasks(tasks, labels)
+	slog.Info("expression accepted", logging.KeyExprID, id, "owner", owner, "priority", priority)
 
 	if len(tasks) == 0 && tree != nil && !calculations.IsOperator(tree.Value) {
 		result, err := strconv.ParseFloat(tree.Value, 64)
 		if err != nil {
-			expr.Status = 3
-			o.Store.AddExpression(expr)
-			http.Error(w, "Invalid number: "+err.Error(), http.StatusUnprocessableEntity)
-			return
+			return models.Expression{}, fmt.Errorf("invalid number: %w", err)
 		}
-		expr.Status = 0
+		expr.Status = models.StatusCompleted
 		expr.Result = result
 		o.Store.AddExpression(expr)
-		log.Printf("Выражение %d завершено без задач: %+v", id, expr)
+		slog.Info("expression completed without tasks", logging.KeyExprID, id, "result", expr.Result)
 	} else {
-		expr.Status = 1
-		for i := len(tasks) - 1; i >= 0; i-- {
-			o.Store.AddTask(tasks[i])
-		}
-		o.Store.AddExpression(expr)
+		expr.Status = models.StatusProcessing
+		scheduled, _ := o.Store.StartExpression(expr, tasks)
+		o.watchDeadline(expr)
+		slog.Info("expression scheduled", logging.KeyExprID, id, "tasks", len(tasks), "scheduled", scheduled)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(struct {
-		ID int `json:"id"`
-	}{ID: id})
+	return expr, nil
+}
+
+func (o *Orchestrator) buildTasks(ctx context.Context, id int, tree *models.Node) ([]models.Task, error) {
+	_, span := tracing.Start(ctx, "calc.BuildTasks", trace.WithAttributes(attribute.Int("expression.id", id)))
+	defer span.End()
+
+	tasks, err := calculations.BuildTasks(fmt.Sprintf("expr-%d", id), tree)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("tasks.count", len(tasks)))
+
+	carrier := tracing.InjectMap(ctx)
+	for i := range tasks {
+		tasks[i].Trace = carrier
+	}
+	return tasks, nil
 }
 
 func (o *Orchestrator) handleGetExpressions(w http.ResponseWriter, r *http.Request) {
@@ -137,26 +345,110 @@ func (o *Orchestrator) handleGetExpressions(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	expressions := o.Store.GetAllExpressions()
+	query, err := ParseExpressionQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page := o.Store.QueryExpressions(query)
+	version := apiVersion(r)
+	expressions := make([]any, 0, len(page.Expressions))
+	for _, expr := range page.Expressions {
+		expressions = append(expressions, presentExpression(expr, version))
+	}
+
+	response := struct {
+		Expressions any    `json:"expressions"`
+		Total       int    `json:"total"`
+		Count       int    `json:"count"`
+		Next        string `json:"next,omitempty"`
+	}{
+		Expressions: expressions,
+		Total:       page.Total,
+		Count:       len(page.Expressions),
+	}
+
+	if query.Fields != nil {
+		selected, err := selectFields(expressions, query.Fields)
+		if err != nil {
+			http.Error(w, "Failed to encode expressions", http.StatusInternalServerError)
+			return
+		}
+		response.Expressions = selected
+	}
+
+	if page.NextCursor != "" {
+		values := r.URL.Query()
+		values.Set("cursor", page.NextCursor)
+		response.Next = r.URL.Path + "?" + values.Encode()
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(struct {
-		Expressions []models.Expression `json:"expressions"`
-	}{Expressions: expressions})
+	json.NewEncoder(w).Encode(response)
 }
 
-func (o *Orchestrator) handleGetExpressionByID(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+func (o *Orchestrator) handleExpressionByID(w http.ResponseWriter, r *http.Request) {
+	idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, apiPrefix(r)+"/expressions/"), "/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || idStr == "" {
+		http.Error(w, "Invalid or missing ID", http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case "":
+	case "events":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		o.handleExpressionEvents(w, r, id, apiVersion(r))
+		return
+	case "trace":
+		o.handleTrace(w, r, id)
+		return
+	case "deliveries":
+		o.handleDeliveries(w, r, id)
+		return
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		o.handleGetExpressionByID(w, id, apiVersion(r))
+	case http.MethodDelete:
+		o.handleCancelExpression(w, r, id)
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (o *Orchestrator) handleCancelExpression(w http.ResponseWriter, r *http.Request, id int) {
+	if expr, exists := o.Store.GetExpression(id); exists && expr.Owner != r.Header.Get("X-User-ID") {
+		http.Error(w, "Expression belongs to another user", http.StatusForbidden)
 		return
 	}
 
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/v1/expressions/")
-	id, err := strconv.Atoi(idStr)
-	if err != nil || idStr == "" {
-		http.Error(w, "Invalid or missing ID", http.StatusBadRequest)
+	expr, err := o.Store.CancelExpression(id)
+	switch {
+	case errors.Is(err, ErrExpressionNotFound):
+		http.Error(w, "Expression not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrExpressionFinished):
+		http.Error(w, "Expression already finished", http.StatusConflict)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Expression any `json:"expression"`
+	}{Expression: presentExpression(expr, apiVersion(r))})
+}
+
+func (o *Orchestrator) handleGetExpressionByID(w http.ResponseWriter, id int, version int) {
 	expr, exists := o.Store.GetExpression(id)
 	if !exists {
 		http.Error(w, "Expression not found", http.StatusNotFound)
@@ -165,6 +457,35 @@ func (o *Orchestrator) handleGetExpressionByID(w http.ResponseWriter, r *http.Re
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(struct {
-		Expression models.Expression `json:"expression"`
-	}{Expression: expr})
+		Expression any `json:"expression"`
+	}{Expression: presentExpression(expr, version)})
+}
+
+func (o *Orchestrator) handlePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats := o.Store.Purge(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func apiVersion(r *http.Request) int {
+	if strings.HasPrefix(r.URL.Path, "/api/v2/") {
+		return 2
+	}
+	return 1
+}
+
+func apiPrefix(r *http.Request) string {
+	return fmt.Sprintf("/api/v%d", apiVersion(r))
+}
+
+func presentExpression(expr models.Expression, version int) any {
+	if version == 1 {
+		return expr.V1()
+	}
+	return expr
 }
@@ -0,0 +1,137 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+	"github.com/pAran0k/calc_go/pkg/metrics"
+)
+
+func calculate(o *Orchestrator, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	o.handleCalculate(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+	return rec
+}
+
+func TestCalculateQueuesLargeExpression(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	terms := make([]string, 159)
+	for i := range terms {
+		terms[i] = strconv.Itoa(i + 1)
+	}
+
+	done := make(chan int, 1)
+	go func() {
+		done <- calculate(o, "/api/v1/calculate", `{"expression": "`+strings.Join(terms, "+")+`"}`).Code
+	}()
+	select {
+	case code := <-done:
+		if code != http.StatusCreated {
+			t.Fatalf("calculate = %d, want 201", code)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("calculate of a 158-task expression blocked")
+	}
+
+	if got := len(o.Store.PendingTasks); got != len(terms)-1 {
+		t.Errorf("queued tasks = %d, want %d", got, len(terms)-1)
+	}
+	if _, ok := o.Store.GetPendingTask(); !ok {
+		t.Error("GetPendingTask returned no task from the large expression")
+	}
+}
+
+func TestCalculateWaitCompletes(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	go func() {
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if task, ok := o.Store.GetPendingTask(); ok {
+				o.Store.UpdateTask(models.Result{TaskID: task.ID, Value: 4}, "")
+				return
+			}
+		}
+	}()
+
+	rec := calculate(o, "/api/v2/calculate?wait=2s", `{"expression": "2+2"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Expression models.Expression `json:"expression"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Expression.Status != models.StatusCompleted || resp.Expression.Result != 4 {
+		t.Errorf("expression = %+v, want completed with 4", resp.Expression)
+	}
+}
+
+func TestCalculateWaitTimesOut(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	rec := calculate(o, "/api/v1/calculate?wait=20ms", `{"expression": "3*3"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `"id":1`) {
+		t.Errorf("body = %s, want expression id", rec.Body)
+	}
+
+	if rec := calculate(o, "/api/v1/calculate?wait=soon", `{"expression": "1+1"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid wait status = %d, want 400", rec.Code)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	calculate(o, "/api/v1/calculate", `{"expression": "2*3"}`)
+	task, _ := o.Store.GetPendingTask()
+	o.Store.UpdateTask(models.Result{TaskID: task.ID, Value: 6, Attempts: 3}, "")
+
+	rec := httptest.NewRecorder()
+	metrics.Handler(o.Store.Metrics).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`calc_tasks_dispatched_total{operation="*"} 1`,
+		`calc_tasks_completed_total{operation="*"} 1`,
+		"calc_result_submission_retries_total 2",
+		`calc_expression_duration_seconds_count{status="completed"} 1`,
+		"calc_queue_tasks 0",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics output is missing %q", want)
+		}
+	}
+}
+
+func TestCancelRequiresOwner(t *testing.T) {
+	o := NewOrchestrator(env.DefaultOrchestratorConfig())
+	expr, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "2+2"}, "alice")
+	if err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+	cancel := func(user string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/expressions/"+strconv.Itoa(expr.Id), nil)
+		req.Header.Set("X-User-ID", user)
+		rec := httptest.NewRecorder()
+		o.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := cancel("mallory"); code != http.StatusForbidden {
+		t.Errorf("cancel by another user = %d, want 403", code)
+	}
+	if got, _ := o.Store.GetExpression(expr.Id); got.Status.IsFinal() {
+		t.Errorf("expression %s after a foreign cancel, want it still running", got.Status)
+	}
+	if code := cancel("alice"); code != http.StatusOK {
+		t.Errorf("cancel by the owner = %d, want 200", code)
+	}
+}
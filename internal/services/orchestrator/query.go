@@ -0,0 +1,224 @@
+package orchestrator
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pAran0k/calc_go/models"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 1000
+)
+
+type ExpressionQuery struct {
+	Limit       int
+	Cursor      *pageCursor
+	Statuses    map[models.Status]bool
+	Owner       string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	SortBy      string
+	Descending  bool
+	Fields      []string
+}
+
+// pageCursor is the sort position of the last expression on a page.
+type pageCursor struct {
+	Key  int64 `json:"k"`
+	ID   int   `json:"i"`
+	Null bool  `json:"n,omitempty"`
+}
+
+func ParseExpressionQuery(values url.Values) (ExpressionQuery, error) {
+	q := ExpressionQuery{Limit: defaultPageLimit, SortBy: "id"}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return q, fmt.Errorf("invalid limit: %s", v)
+		}
+		q.Limit = min(limit, maxPageLimit)
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid cursor")
+		}
+		var cursor pageCursor
+		if err := json.Unmarshal(raw, &cursor); err != nil {
+			return q, fmt.Errorf("invalid cursor")
+		}
+		q.Cursor = &cursor
+	}
+
+	if v := values.Get("status"); v != "" {
+		q.Statuses = make(map[models.Status]bool)
+		for _, part := range strings.Split(v, ",") {
+			status, err := models.ParseStatus(strings.TrimSpace(part))
+			if err != nil {
+				return q, err
+			}
+			q.Statuses[status] = true
+		}
+	}
+
+	q.Owner = values.Get("owner")
+
+	for name, target := range map[string]*time.Time{"created_from": &q.CreatedFrom, "created_to": &q.CreatedTo} {
+		if v := values.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s: %s", name, v)
+			}
+			*target = t
+		}
+	}
+
+	if v := values.Get("sort"); v != "" {
+		if v != "id" && v != "created" && v != "finished" {
+			return q, fmt.Errorf("invalid sort: %s", v)
+		}
+		q.SortBy = v
+	}
+
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return q, fmt.Errorf("invalid order: %s", values.Get("order"))
+	}
+
+	if v := values.Get("fields"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				q.Fields = append(q.Fields, field)
+			}
+		}
+	}
+
+	return q, nil
+}
+
+func (q ExpressionQuery) matches(expr models.Expression) bool {
+	if q.Statuses != nil && !q.Statuses[expr.Status] {
+		return false
+	}
+	if q.Owner != "" && expr.Owner != q.Owner {
+		return false
+	}
+	if !q.CreatedFrom.IsZero() && expr.CreatedAt.Before(q.CreatedFrom) {
+		return false
+	}
+	if !q.CreatedTo.IsZero() && !expr.CreatedAt.Before(q.CreatedTo) {
+		return false
+	}
+	return true
+}
+
+// sortKey is the position of expr in the requested order. Unfinished
+// expressions have no finish time and sort last in either direction, by id.
+func (q ExpressionQuery) sortKey(expr models.Expression) pageCursor {
+	switch q.SortBy {
+	case "created":
+		return pageCursor{Key: expr.CreatedAt.UnixNano(), ID: expr.Id}
+	case "finished":
+		if expr.FinishedAt == nil {
+			return pageCursor{ID: expr.Id, Null: true}
+		}
+		return pageCursor{Key: expr.FinishedAt.UnixNano(), ID: expr.Id}
+	default:
+		return pageCursor{Key: int64(expr.Id), ID: expr.Id}
+	}
+}
+
+func (q ExpressionQuery) less(a, b models.Expression) bool {
+	return q.before(q.sortKey(a), q.sortKey(b))
+}
+
+func (q ExpressionQuery) before(a, b pageCursor) bool {
+	if a.Null != b.Null {
+		return b.Null
+	}
+	c := cmp.Compare(a.Key, b.Key)
+	if c == 0 {
+		c = cmp.Compare(a.ID, b.ID)
+	}
+	if q.Descending {
+		return c > 0
+	}
+	return c < 0
+}
+
+func (q ExpressionQuery) afterCursor(expr models.Expression) bool {
+	if q.Cursor == nil {
+		return true
+	}
+	return q.before(*q.Cursor, q.sortKey(expr))
+}
+
+type ExpressionPage struct {
+	Expressions []models.Expression
+	Total       int
+	NextCursor  string
+}
+
+func (s *Store) QueryExpressions(q ExpressionQuery) ExpressionPage {
+	s.Mu.Lock()
+	var matched []models.Expression
+	for _, expr := range s.Expressions {
+		if q.matches(expr) {
+			matched = append(matched, expr)
+		}
+	}
+	s.Mu.Unlock()
+
+	sort.Slice(matched, func(i, j int) bool { return q.less(matched[i], matched[j]) })
+
+	page := ExpressionPage{Total: len(matched), Expressions: []models.Expression{}}
+	for _, expr := range matched {
+		if !q.afterCursor(expr) {
+			continue
+		}
+		if len(page.Expressions) == q.Limit {
+			last := page.Expressions[len(page.Expressions)-1]
+			raw, _ := json.Marshal(q.sortKey(last))
+			page.NextCursor = base64.RawURLEncoding.EncodeToString(raw)
+			break
+		}
+		page.Expressions = append(page.Expressions, expr)
+	}
+	return page
+}
+
+func selectFields(expressions []any, fields []string) ([]map[string]json.RawMessage, error) {
+	result := make([]map[string]json.RawMessage, 0, len(expressions))
+	for _, expr := range expressions {
+		raw, err := json.Marshal(expr)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &all); err != nil {
+			return nil, err
+		}
+		selected := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := all[field]; ok {
+				selected[field] = value
+			}
+		}
+		result = append(result, selected)
+	}
+	return result, nil
+}
@@ -0,0 +1,144 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+)
+
+func newQueryStore() *Store {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for id := 1; id <= 5; id++ {
+		owner := "alice"
+		if id%2 == 0 {
+			owner = "bob"
+		}
+		st.AddExpression(models.Expression{
+			Id:        id,
+			Status:    models.Status(id % 2),
+			Owner:     owner,
+			CreatedAt: base.Add(time.Duration(6-id) * time.Minute),
+			Node:      &models.Node{Value: "1"},
+		})
+	}
+	return st
+}
+
+func TestQueryExpressionsPagination(t *testing.T) {
+	st := newQueryStore()
+	query, err := ParseExpressionQuery(url.Values{"limit": {"2"}, "sort": {"created"}})
+	if err != nil {
+		t.Fatalf("ParseExpressionQuery unexpected error: %v", err)
+	}
+
+	var ids []int
+	for {
+		page := st.QueryExpressions(query)
+		if page.Total != 5 {
+			t.Fatalf("Total = %d, want 5", page.Total)
+		}
+		for _, expr := range page.Expressions {
+			ids = append(ids, expr.Id)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query, _ = ParseExpressionQuery(url.Values{"limit": {"2"}, "sort": {"created"}, "cursor": {page.NextCursor}})
+	}
+
+	want := []int{5, 4, 3, 2, 1}
+	if len(ids) != len(want) {
+		t.Fatalf("paged ids = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("paged ids = %v, want %v", ids, want)
+		}
+	}
+}
+
+func TestQueryExpressionsByFinishTime(t *testing.T) {
+	st := newQueryStore()
+	pages := func(order string, between func()) []int {
+		values := url.Values{"limit": {"2"}, "sort": {"finished"}, "order": {order}}
+		var ids []int
+		for {
+			query, err := ParseExpressionQuery(values)
+			if err != nil {
+				t.Fatalf("ParseExpressionQuery unexpected error: %v", err)
+			}
+			page := st.QueryExpressions(query)
+			for _, expr := range page.Expressions {
+				ids = append(ids, expr.Id)
+			}
+			if page.NextCursor == "" {
+				return ids
+			}
+			values.Set("cursor", page.NextCursor)
+			if between != nil {
+				between()
+				between = nil
+			}
+		}
+	}
+
+	// Expressions 2 and 4 are finished, 1, 3 and 5 are still running and
+	// come last in either order.
+	if got := pages("desc", nil); fmt.Sprint(got) != "[4 2 5 3 1]" {
+		t.Errorf("desc pages = %v, want [4 2 5 3 1]", got)
+	}
+	// Expression 1 finishing after the first page moves into the finished
+	// part ahead of the cursor and is listed once, without shifting the
+	// unfinished ones.
+	finish := func() {
+		st.CancelExpression(1)
+	}
+	if got := pages("asc", finish); fmt.Sprint(got) != "[2 4 1 3 5]" {
+		t.Errorf("asc pages = %v, want [2 4 1 3 5]", got)
+	}
+}
+
+func TestQueryExpressionsFilters(t *testing.T) {
+	st := newQueryStore()
+	query, err := ParseExpressionQuery(url.Values{"status": {"1"}, "owner": {"alice"}, "order": {"desc"}})
+	if err != nil {
+		t.Fatalf("ParseExpressionQuery unexpected error: %v", err)
+	}
+	page := st.QueryExpressions(query)
+	if page.Total != 3 || page.Expressions[0].Id != 5 {
+		t.Errorf("QueryExpressions() = %+v, want 3 expressions starting with 5", page)
+	}
+
+	if _, err := ParseExpressionQuery(url.Values{"sort": {"name"}}); err == nil {
+		t.Errorf("ParseExpressionQuery should reject unknown sort field")
+	}
+}
+
+func TestHandleGetExpressionsFields(t *testing.T) {
+	o := &Orchestrator{Store: newQueryStore()}
+	rec := httptest.NewRecorder()
+	o.handleGetExpressions(rec, httptest.NewRequest(http.MethodGet, "/api/v1/expressions?limit=1&fields=id,status", nil))
+
+	var response struct {
+		Expressions []map[string]any `json:"expressions"`
+		Total       int              `json:"total"`
+		Next        string           `json:"next"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(response.Expressions) != 1 || response.Total != 5 || response.Next == "" {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+	if _, ok := response.Expressions[0]["node"]; ok {
+		t.Errorf("node should be omitted when not listed in fields")
+	}
+}
@@ -0,0 +1,263 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/pkg/election"
+)
+
+const (
+	electionInterval = time.Second
+	// replicaSyncInterval is how often the leader writes the shared snapshot
+	// and followers reload it.
+	replicaSyncInterval = time.Second
+	// forwardedHeader marks a request a follower forwarded to the leader. A
+	// replica that has just lost leadership answers it with 503 rather than
+	// forwarding it once more.
+	forwardedHeader = "X-Forwarded-By-Replica"
+)
+
+func newElector(config env.OrchestratorConfig) *election.Elector {
+	if config.LeaderLockPath == "" {
+		return nil
+	}
+	id := config.ReplicaID
+	if id == "" {
+		id = uuid.NewString()
+	}
+	return election.New(config.LeaderLockPath, id, config.AdvertisedURL(), electionInterval)
+}
+
+// IsLeader reports whether this replica leads and has loaded the shared
+// state. A replica running without leader election is always the leader.
+func (o *Orchestrator) IsLeader() bool {
+	return o.Elector == nil || o.leading.Load()
+}
+
+// campaign runs leader election until ctx is done. While this replica leads
+// it owns the store: it dispatches tasks, expires deadlines, purges old
+// expressions and writes the shared snapshot. Otherwise it keeps its store in
+// sync with that snapshot to serve reads.
+func (o *Orchestrator) campaign(ctx context.Context) {
+	var stopLeading func()
+	o.Elector.OnChange(func(leader bool) {
+		o.replicaMu.Lock()
+		defer o.replicaMu.Unlock()
+		if !leader {
+			o.leading.Store(false)
+			if stopLeading != nil {
+				stopLeading()
+				stopLeading = nil
+			}
+			return
+		}
+
+		o.takeOver()
+		leadCtx, cancel := context.WithCancel(ctx)
+		written := make(chan struct{})
+		go o.Store.RunJanitor(leadCtx, o.GCInterval)
+		go func() {
+			defer close(written)
+			o.writeShared(leadCtx)
+		}()
+		// The last write finishes before the lock is released, so the next
+		// leader starts from everything this one accepted.
+		stopLeading = func() {
+			cancel()
+			<-written
+		}
+		o.leading.Store(true)
+	})
+	go o.followShared(ctx)
+	o.Elector.Run(ctx)
+}
+
+// takeOver loads the shared snapshot before this replica starts leading, so
+// that it continues from the state the previous leader last wrote.
+func (o *Orchestrator) takeOver() {
+	snap, err := LoadSnapshot(o.SnapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err == nil {
+		err = o.Store.Replace(snap)
+	}
+	if err != nil {
+		slog.Error("shared snapshot load failed", "path", o.SnapshotPath, "error", err)
+		return
+	}
+	o.resumeExpressions(snap)
+	slog.Info("leadership taken over", "replica", o.Elector.ID(), "expressions", len(snap.Expressions), "taken_at", snap.TakenAt)
+}
+
+// writeShared saves the store to the shared snapshot every sync interval and
+// once more when ctx is done. The periodic writes carry over what persist
+// does not cover, such as dispatches and expired deadlines.
+func (o *Orchestrator) writeShared(ctx context.Context) {
+	ticker := time.NewTicker(o.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			o.saveShared(0)
+			return
+		case <-ticker.C:
+			o.saveShared(0)
+		}
+	}
+}
+
+// persist writes the shared snapshot before the leader acknowledges a state
+// change, so that a leader dying right after answering loses nothing it
+// accepted. Without replicas it does nothing.
+func (o *Orchestrator) persist() {
+	if !o.leading.Load() {
+		return
+	}
+	o.saveShared(o.writeRequests.Add(1))
+}
+
+// saveShared writes the store to the shared snapshot. Writes are serialized
+// so that an older snapshot never replaces a newer one. A persist request
+// is skipped when a write that started after it was made has already
+// finished, so concurrent requests share one write, and once this replica
+// stops leading; the final write of a resigning leader passes 0 and always
+// goes through.
+func (o *Orchestrator) saveShared(request uint64) {
+	o.sharedMu.Lock()
+	defer o.sharedMu.Unlock()
+	if request != 0 && (!o.leading.Load() || o.written >= request) {
+		return
+	}
+	upTo := o.writeRequests.Load()
+	if err := SaveSnapshot(o.SnapshotPath, o.Store.Snapshot()); err != nil {
+		slog.Error("snapshot write failed", "path", o.SnapshotPath, "error", err)
+		return
+	}
+	o.written = upTo
+}
+
+// followShared reloads the shared snapshot whenever the leader has rewritten
+// it while this replica follows.
+func (o *Orchestrator) followShared(ctx context.Context) {
+	ticker := time.NewTicker(o.syncInterval)
+	defer ticker.Stop()
+	var loaded time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		o.replicaMu.Lock()
+		if info, err := os.Stat(o.SnapshotPath); err == nil && !o.IsLeader() && !info.ModTime().Equal(loaded) {
+			snap, err := LoadSnapshot(o.SnapshotPath)
+			if err == nil {
+				err = o.Store.Replace(snap)
+			}
+			if err != nil {
+				slog.Warn("shared snapshot load failed", "path", o.SnapshotPath, "error", err)
+			} else {
+				loaded = info.ModTime()
+			}
+		}
+		o.replicaMu.Unlock()
+	}
+}
+
+// onLeader runs h on the leader. Other replicas forward the request there,
+// except for plain expression reads, which they answer from their copy of
+// the shared snapshot.
+func (o *Orchestrator) onLeader(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if o.IsLeader() || isExpressionRead(r) {
+			if r.Method != http.MethodGet {
+				w = &persistingWriter{ResponseWriter: w, persist: o.persist}
+			}
+			h(w, r)
+			return
+		}
+		o.forwardToLeader(w, r)
+	}
+}
+
+// persistingWriter persists the store before the first successful response
+// byte goes out, so a client is only told about changes the next leader will
+// see.
+type persistingWriter struct {
+	http.ResponseWriter
+	persist func()
+	once    sync.Once
+}
+
+func (w *persistingWriter) WriteHeader(code int) {
+	w.once.Do(func() {
+		if code < http.StatusBadRequest {
+			w.persist()
+		}
+	})
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *persistingWriter) Write(b []byte) (int, error) {
+	w.once.Do(w.persist)
+	return w.ResponseWriter.Write(b)
+}
+
+func isExpressionRead(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, apiPrefix(r)+"/expressions")
+	if !ok {
+		return false
+	}
+	return rest == "" || (strings.HasPrefix(rest, "/") && !strings.Contains(rest[1:], "/"))
+}
+
+func (o *Orchestrator) forwardToLeader(w http.ResponseWriter, r *http.Request) {
+	leader, err := o.Elector.Leader()
+	if err != nil || leader == "" || leader == o.Elector.ID() || r.Header.Get(forwardedHeader) != "" {
+		http.Error(w, "No leader available", http.StatusServiceUnavailable)
+		return
+	}
+	addr, _ := o.Elector.LeaderAddr()
+	target, err := url.Parse(addr)
+	if err != nil || target.Host == "" {
+		http.Error(w, "No leader available", http.StatusServiceUnavailable)
+		return
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		slog.Warn("request forwarding to leader failed", "leader", leader, "error", err)
+		http.Error(w, "Leader unavailable", http.StatusBadGateway)
+	}
+	r.Header.Set(forwardedHeader, o.Elector.ID())
+	proxy.ServeHTTP(w, r)
+}
+
+// checkLeadership never fails: a follower is as ready to serve as the leader.
+func (o *Orchestrator) checkLeadership(context.Context) (string, error) {
+	if o.IsLeader() {
+		return fmt.Sprintf("leader (replica %s)", o.Elector.ID()), nil
+	}
+	leader, err := o.Elector.Leader()
+	if err != nil || leader == "" {
+		return fmt.Sprintf("follower (replica %s), no leader", o.Elector.ID()), nil
+	}
+	return fmt.Sprintf("follower (replica %s), leader %s", o.Elector.ID(), leader), nil
+}
@@ -0,0 +1,256 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+	"github.com/pAran0k/calc_go/pkg/election"
+)
+
+func TestReplicasShareLeaderState(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, "leader.lock")
+	replicas := make([]*Orchestrator, 3)
+	servers := make([]*httptest.Server, 3)
+	stops := make([]context.CancelFunc, 3)
+	var campaigns sync.WaitGroup
+	for i := range replicas {
+		config := env.DefaultOrchestratorConfig()
+		config.LeaderLockPath = lockPath
+		config.SnapshotPath = filepath.Join(dir, "store.json")
+		config.ReplicaID = fmt.Sprintf("replica-%d", i)
+		replicas[i] = NewOrchestrator(config)
+		servers[i] = httptest.NewServer(replicas[i].Handler())
+		defer servers[i].Close()
+		replicas[i].Elector = election.New(lockPath, config.ReplicaID, servers[i].URL, 10*time.Millisecond)
+		replicas[i].syncInterval = 10 * time.Millisecond
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stops[i] = cancel
+		campaigns.Go(func() { replicas[i].campaign(ctx) })
+	}
+	// The leader's last snapshot write must finish before the temporary
+	// directory is removed.
+	defer func() {
+		for _, stop := range stops {
+			stop()
+		}
+		campaigns.Wait()
+	}()
+
+	waitLeader := func(candidates []int) int {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			var leaders []int
+			for _, i := range candidates {
+				if replicas[i].IsLeader() {
+					leaders = append(leaders, i)
+				}
+			}
+			if len(leaders) > 1 {
+				t.Fatalf("replicas %v are all leaders", leaders)
+			}
+			if len(leaders) == 1 {
+				return leaders[0]
+			}
+		}
+		t.Fatal("no leader elected")
+		return -1
+	}
+	send := func(i int, method, path, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, servers[i].URL+path, strings.NewReader(body))
+		req.Header.Set(models.AgentIDHeader, "agent-1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s on replica %d: %v", method, path, i, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	submit := func(i int, expression string) int {
+		t.Helper()
+		resp := send(i, http.MethodPost, "/api/v1/calculate", fmt.Sprintf(`{"expression": %q}`, expression))
+		var created struct {
+			ID int `json:"id"`
+		}
+		if resp.StatusCode != http.StatusCreated || json.NewDecoder(resp.Body).Decode(&created) != nil {
+			t.Fatalf("calculate on replica %d = %d, want 201", i, resp.StatusCode)
+		}
+		return created.ID
+	}
+	poll := func(i int) models.Task {
+		t.Helper()
+		resp := send(i, http.MethodGet, "/internal/task", "")
+		var polled struct {
+			Task models.Task `json:"task"`
+		}
+		if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&polled) != nil {
+			t.Fatalf("task poll on replica %d = %d, want 200", i, resp.StatusCode)
+		}
+		return polled.Task
+	}
+
+	leader := waitLeader([]int{0, 1, 2})
+	var followers []int
+	for i, o := range replicas {
+		code, report := probe(t, o, "/readyz")
+		if code != http.StatusOK {
+			t.Errorf("replica %d /readyz = %d, want 200", i, code)
+		}
+		detail := report.Checks["leadership"].Detail
+		if i == leader && !strings.HasPrefix(detail, "leader") {
+			t.Errorf("leader replica %d reports %q", i, detail)
+		}
+		if i != leader {
+			followers = append(followers, i)
+			if !strings.Contains(detail, fmt.Sprintf("leader replica-%d", leader)) {
+				t.Errorf("follower replica %d reports %q, want leader replica-%d", i, detail, leader)
+			}
+		}
+	}
+
+	// Followers hand submissions and agent traffic to the leader, so only
+	// the leader's store schedules and dispatches.
+	first := submit(followers[0], "2+2")
+	task := poll(followers[1])
+	if resp := send(followers[0], http.MethodGet, "/internal/task", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("second poll = %d, want 404 once the only task is dispatched", resp.StatusCode)
+	}
+	for _, i := range followers {
+		if n := replicas[i].Store.InFlightTasks(); n != 0 {
+			t.Errorf("follower replica %d dispatched %d tasks itself", i, n)
+		}
+	}
+	result := fmt.Sprintf(`{"task_id": %q, "value": 4}`, task.ID)
+	if resp := send(followers[0], http.MethodPost, "/internal/task", result); resp.StatusCode != http.StatusOK {
+		t.Fatalf("result via follower = %d, want 200", resp.StatusCode)
+	}
+	if expr, ok := replicas[leader].Store.GetExpression(first); !ok || expr.Status != models.StatusCompleted {
+		t.Errorf("leader has expression %+v, want completed", expr)
+	}
+
+	// Followers read from the shared snapshot the leader keeps writing.
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if expr, ok := replicas[followers[1]].Store.GetExpression(first); ok && expr.Status == models.StatusCompleted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("follower never saw the completed expression")
+		}
+	}
+	if resp := send(followers[1], http.MethodGet, fmt.Sprintf("/api/v1/expressions/%d", first), ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("read on follower = %d, want 200 from its own store", resp.StatusCode)
+	}
+
+	second := submit(followers[0], "3*3")
+	dispatched := poll(followers[0])
+
+	// The next leader continues from the shared state: the task the old
+	// leader had dispatched goes back to the queue.
+	stops[leader]()
+	next := waitLeader(followers)
+	if replicas[leader].IsLeader() {
+		t.Errorf("stopped replica %d still reports leadership", leader)
+	}
+	if got, _ := replicas[next].Elector.Leader(); got != fmt.Sprintf("replica-%d", next) {
+		t.Errorf("lock file names %q, want replica-%d", got, next)
+	}
+	if expr, ok := replicas[next].Store.GetExpression(first); !ok || expr.Status != models.StatusCompleted {
+		t.Errorf("new leader has expression %+v, want completed", expr)
+	}
+	if again := poll(leader); again.ID != dispatched.ID {
+		t.Errorf("new leader dispatched %s, want the requeued %s", again.ID, dispatched.ID)
+	}
+	if third := submit(leader, "1-1"); third <= second {
+		t.Errorf("new leader assigned id %d, want more than %d", third, second)
+	}
+}
+
+func TestLeaderPersistsBeforeAcknowledging(t *testing.T) {
+	dir := t.TempDir()
+	config := env.DefaultOrchestratorConfig()
+	config.LeaderLockPath = filepath.Join(dir, "leader.lock")
+	config.SnapshotPath = filepath.Join(dir, "store.json")
+	o := NewOrchestrator(config)
+	server := httptest.NewServer(o.Handler())
+	defer server.Close()
+	o.Elector = election.New(config.LeaderLockPath, "replica-0", server.URL, 10*time.Millisecond)
+	// No periodic write happens during the test: whatever the snapshot holds
+	// was written before the response.
+	o.syncInterval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var campaigns sync.WaitGroup
+	campaigns.Go(func() { o.campaign(ctx) })
+	defer func() {
+		cancel()
+		campaigns.Wait()
+	}()
+	for deadline := time.Now().Add(2 * time.Second); !o.IsLeader(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("replica never became leader")
+		}
+	}
+
+	send := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set(models.AgentIDHeader, "agent-1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	shared := func(id int) models.Expression {
+		t.Helper()
+		snap, err := LoadSnapshot(config.SnapshotPath)
+		if err != nil {
+			t.Fatalf("LoadSnapshot: %v", err)
+		}
+		for _, expr := range snap.Expressions {
+			if expr.Id == id {
+				return expr
+			}
+		}
+		t.Fatalf("expression %d is not in the shared snapshot", id)
+		return models.Expression{}
+	}
+
+	resp := send(http.MethodPost, "/api/v1/calculate", `{"expression": "2+2"}`)
+	var created struct {
+		ID int `json:"id"`
+	}
+	if resp.StatusCode != http.StatusCreated || json.NewDecoder(resp.Body).Decode(&created) != nil {
+		t.Fatalf("calculate = %d, want 201", resp.StatusCode)
+	}
+	if expr := shared(created.ID); expr.Status != models.StatusProcessing {
+		t.Errorf("shared expression is %s, want processing", expr.Status)
+	}
+
+	var polled struct {
+		Task models.Task `json:"task"`
+	}
+	if resp := send(http.MethodGet, "/internal/task", ""); resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&polled) != nil {
+		t.Fatalf("task poll = %d, want 200", resp.StatusCode)
+	}
+	result := fmt.Sprintf(`{"task_id": %q, "value": 4}`, polled.Task.ID)
+	if resp := send(http.MethodPost, "/internal/task", result); resp.StatusCode != http.StatusOK {
+		t.Fatalf("result = %d, want 200", resp.StatusCode)
+	}
+	if expr := shared(created.ID); expr.Status != models.StatusCompleted || expr.Result != 4 {
+		t.Errorf("shared expression is %s with %v, want completed with 4", expr.Status, expr.Result)
+	}
+}
@@ -0,0 +1,119 @@
+package orchestrator
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/pAran0k/calc_go/models"
+)
+
+type PurgeStats struct {
+	Expressions int `json:"expressions"`
+	Tasks       int `json:"tasks"`
+}
+
+func (s *Store) markFinished(id int) {
+	if _, ok := s.finishedAt[id]; ok {
+		return
+	}
+	expr, ok := s.Expressions[id]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	s.finishedAt[id] = now
+	expr.FinishedAt = &now
+	s.Expressions[id] = expr
+	s.metrics.observeExpression(expr)
+	s.Events.Publish(Event{Type: EventExpressionFinished, ExpressionID: id, Error: expr.Error, Expression: &expr, Time: now})
+	for _, hook := range s.finishHooks {
+		go hook(expr)
+	}
+}
+
+func (s *Store) OnExpressionFinished(hook func(models.Expression)) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.finishHooks = append(s.finishHooks, hook)
+}
+
+// OnExpressionDeleted registers a hook run, under the store lock, when
+// retention deletes an expression.
+func (s *Store) OnExpressionDeleted(hook func(id int)) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.deleteHooks = append(s.deleteHooks, hook)
+}
+
+func (s *Store) Purge(now time.Time) PurgeStats {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	var stats PurgeStats
+	for id := range s.finishedAt {
+		if _, ok := s.exprTasks[id]; ok {
+			stats.Tasks += s.releaseExpressionTasks(id)
+		}
+	}
+
+	var finished []int
+	for id, at := range s.finishedAt {
+		if s.ttl > 0 && now.Sub(at) >= s.ttl {
+			s.deleteExpression(id)
+			stats.Expressions++
+			continue
+		}
+		finished = append(finished, id)
+	}
+
+	if s.maxExpressions > 0 && len(s.Expressions) > s.maxExpressions {
+		sort.Slice(finished, func(i, j int) bool {
+			return s.finishedAt[finished[i]].Before(s.finishedAt[finished[j]])
+		})
+		for _, id := range finished {
+			if len(s.Expressions) <= s.maxExpressions {
+				break
+			}
+			s.deleteExpression(id)
+			stats.Expressions++
+		}
+	}
+
+	for taskID, at := range s.cancelledTasks {
+		if s.ttl > 0 && now.Sub(at) >= s.ttl {
+			delete(s.cancelledTasks, taskID)
+		}
+	}
+
+	if stats.Expressions > 0 || stats.Tasks > 0 {
+		slog.Info("store purged", "expressions", stats.Expressions, "tasks", stats.Tasks)
+	}
+	return stats
+}
+
+func (s *Store) deleteExpression(id int) {
+	delete(s.Expressions, id)
+	delete(s.finishedAt, id)
+	s.forgetTraces(id)
+	for _, hook := range s.deleteHooks {
+		hook(id)
+	}
+}
+
+func (s *Store) RunJanitor(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.Purge(now)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package orchestrator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+)
+
+func TestPurgeCompactsAndExpires(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	st.ttl = time.Hour
+	st.maxExpressions = 0
+	var deleted []int
+	st.OnExpressionDeleted(func(id int) { deleted = append(deleted, id) })
+
+	node := &models.Node{Value: "+", Left: &models.Node{Value: "1"}, Right: &models.Node{Value: "2"}}
+	st.AddExpression(models.Expression{Id: 1, Status: models.StatusProcessing, Node: node})
+	st.AddExpressionTasks(1, []models.Task{{ID: "task-expr-1-0", Arg1: "1", Arg2: "2", Operation: "+", Hash: "h"}})
+	st.AddExpression(models.Expression{Id: 2, Status: models.StatusProcessing})
+	st.GetPendingTask()
+	st.UpdateTask(models.Result{TaskID: "task-expr-1-0", Value: 3}, "")
+
+	stats := st.Purge(time.Now())
+	if stats.Tasks != 1 || stats.Expressions != 0 {
+		t.Errorf("Purge() = %+v, want 1 compacted task and no expired expressions", stats)
+	}
+	if len(st.Tasks) != 0 {
+		t.Errorf("completed tasks were not compacted: %+v", st.Tasks)
+	}
+
+	stats = st.Purge(time.Now().Add(2 * time.Hour))
+	if stats.Expressions != 1 {
+		t.Errorf("Purge() after TTL = %+v, want 1 expired expression", stats)
+	}
+	if _, ok := st.GetExpression(1); ok {
+		t.Errorf("expired expression 1 is still stored")
+	}
+	if len(deleted) != 1 || deleted[0] != 1 {
+		t.Errorf("delete hooks ran for %v, want [1]", deleted)
+	}
+	if _, ok := st.GetExpression(2); !ok {
+		t.Errorf("unfinished expression 2 must not expire")
+	}
+}
+
+func TestPurgeMaxExpressions(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	st.ttl = 0
+	st.maxExpressions = 2
+
+	for id := 1; id <= 3; id++ {
+		finishedAt := time.Now().Add(time.Duration(id) * time.Second)
+		st.AddExpression(models.Expression{Id: id, Status: models.StatusCompleted, FinishedAt: &finishedAt})
+	}
+
+	if stats := st.Purge(time.Now()); stats.Expressions != 1 {
+		t.Errorf("Purge() = %+v, want 1 expression removed", stats)
+	}
+	if _, ok := st.GetExpression(1); ok {
+		t.Errorf("oldest expression 1 should be removed first")
+	}
+}
@@ -0,0 +1,132 @@
+package orchestrator
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pAran0k/calc_go/models"
+	"github.com/pAran0k/calc_go/pkg/logging"
+)
+
+// agentStaleAfter is how long an agent that stopped contacting the
+// orchestrator still counts when deciding whether a task can run anywhere.
+// Busy agents do not poll, but they fetch dependency results, check for
+// cancellation while they wait and report results, and each of those
+// requests counts as a sign of life.
+const agentStaleAfter = time.Minute
+
+type agentSeen struct {
+	caps     models.Capabilities
+	lastSeen time.Time
+}
+
+// labelTasks copies the labels an expression requires onto its tasks. The
+// labels become part of the task hash so that labelled and unlabelled work
+// is neither merged nor served from each other's cached results.
+func labelTasks(tasks []models.Task, labels []string) {
+	if len(labels) == 0 {
+		return
+	}
+	suffix := "|" + strings.Join(labels, ",")
+	for i := range tasks {
+		tasks[i].Labels = labels
+		if tasks[i].Hash != "" {
+			tasks[i].Hash += suffix
+		}
+	}
+}
+
+// ObserveAgent records the capabilities an agent polled with. When the set
+// of live agents changes, unfinished expressions are re-checked for tasks
+// none of them can run.
+func (s *Store) ObserveAgent(id string, caps models.Capabilities) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	now := time.Now()
+	seen, known := s.agents[id]
+	changed := !known ||
+		!slices.Equal(seen.caps.Operations, caps.Operations) ||
+		!slices.Equal(seen.caps.Labels, caps.Labels)
+	s.agents[id] = agentSeen{caps: caps, lastSeen: now}
+	if id != "" {
+		s.renewLeases(id, now)
+	}
+
+	for agentID, agent := range s.agents {
+		if now.Sub(agent.lastSeen) > agentStaleAfter {
+			delete(s.agents, agentID)
+			changed = true
+		}
+	}
+	if changed {
+		for exprID, expr := range s.Expressions {
+			if !expr.Status.IsFinal() {
+				s.refreshRouting(exprID)
+			}
+		}
+	}
+}
+
+// TouchAgent records that an agent is still alive without changing what it
+// is known to run, and renews the leases of the tasks it holds.
+func (s *Store) TouchAgent(id string) {
+	if id == "" {
+		return
+	}
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	now := time.Now()
+	if seen, known := s.agents[id]; known {
+		seen.lastSeen = now
+		s.agents[id] = seen
+	}
+	s.renewLeases(id, now)
+}
+
+// routable reports whether some live agent accepts the task. Until the first
+// agent polls nothing is known about capabilities and every task counts as
+// routable. Callers hold s.Mu.
+func (s *Store) routable(task models.Task) bool {
+	if len(s.agents) == 0 {
+		return true
+	}
+	for _, agent := range s.agents {
+		if agent.caps.Accepts(task) {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshRouting recounts the pending tasks of an expression that no live
+// agent can run. Callers hold s.Mu.
+func (s *Store) refreshRouting(exprID int) {
+	expr, exists := s.Expressions[exprID]
+	if !exists {
+		return
+	}
+	unroutable := 0
+	for _, taskID := range s.exprTasks[exprID] {
+		task, exists := s.Tasks[taskID]
+		if !exists || task.Completed {
+			continue
+		}
+		if _, running := s.dispatched[taskID]; running {
+			continue
+		}
+		if !s.routable(task) {
+			unroutable++
+		}
+	}
+	if unroutable == expr.UnroutableTasks {
+		return
+	}
+	if expr.UnroutableTasks == 0 {
+		slog.Warn("expression has tasks no agent can run", logging.KeyExprID, exprID, "tasks", unroutable, "labels", expr.Labels)
+	}
+	expr.UnroutableTasks = unroutable
+	s.Expressions[exprID] = expr
+}
@@ -0,0 +1,138 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+)
+
+func poll(st *Store, agentID, operations, labels string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/internal/task", nil)
+	req.Header.Set(models.AgentIDHeader, agentID)
+	if operations != "" {
+		req.Header.Set(models.AgentOperationsHeader, operations)
+	}
+	if labels != "" {
+		req.Header.Set(models.AgentLabelsHeader, labels)
+	}
+	rec := httptest.NewRecorder()
+	handleGetTask(rec, req, st)
+	return rec
+}
+
+func polledTask(t *testing.T, rec *httptest.ResponseRecorder) models.Task {
+	t.Helper()
+	var response struct {
+		Task models.Task `json:"task"`
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("poll = %d, want 200", rec.Code)
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("decode task: %v", err)
+	}
+	return response.Task
+}
+
+func TestDispatchMatchesAgentCapabilities(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	if _, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "8/2"}, ""); err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+	big, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "3+4", Labels: []string{"BigNum"}}, "")
+	if err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+
+	if rec := poll(o.Store, "adder", "+,-", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("adder without labels got %d, want 404", rec.Code)
+	}
+	if task := polledTask(t, poll(o.Store, "bignum", "+", "bignum")); task.Operation != "+" || len(task.Labels) != 1 || task.Labels[0] != "bignum" {
+		t.Errorf("bignum agent got %+v, want the labelled addition", task)
+	}
+	if rec := poll(o.Store, "bignum", "+", "bignum"); rec.Code != http.StatusNotFound {
+		t.Errorf("bignum agent got %d for division, want 404", rec.Code)
+	}
+	if task := polledTask(t, poll(o.Store, "any", "", "")); task.Operation != "/" {
+		t.Errorf("general agent got %+v, want the division", task)
+	}
+	if expr, _ := o.Store.GetExpression(big.Id); expr.UnroutableTasks != 0 {
+		t.Errorf("unroutable_tasks = %d, want 0", expr.UnroutableTasks)
+	}
+
+	if rec := poll(o.Store, "broken", "%", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("poll with unknown operation = %d, want 400", rec.Code)
+	}
+}
+
+func TestUnsatisfiableTasksAreFlagged(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	poll(o.Store, "adder", "+", "")
+
+	expr, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "(1+2)*3+4"}, "")
+	if err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+	if got, _ := o.Store.GetExpression(expr.Id); got.UnroutableTasks != 1 {
+		t.Errorf("unroutable_tasks = %d, want 1 for the multiplication", got.UnroutableTasks)
+	}
+
+	poll(o.Store, "multiplier", "*", "")
+	if got, _ := o.Store.GetExpression(expr.Id); got.UnroutableTasks != 0 {
+		t.Errorf("unroutable_tasks after a multiplier polled = %d, want 0", got.UnroutableTasks)
+	}
+
+	labelled, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "5-1", Labels: []string{"gpu"}}, "")
+	if err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+	if got, _ := o.Store.GetExpression(labelled.Id); got.UnroutableTasks != 1 {
+		t.Errorf("unroutable_tasks = %d, want 1 for the gpu subtraction", got.UnroutableTasks)
+	}
+
+	if _, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "1+1", Labels: []string{"a,b"}}, ""); err == nil {
+		t.Error("label with a comma accepted")
+	}
+}
+
+func TestLabelledTasksAreNotMerged(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	for _, labels := range [][]string{nil, {"bignum"}} {
+		if _, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "2+2", Labels: labels}, ""); err != nil {
+			t.Fatalf("submitExpression unexpected error: %v", err)
+		}
+	}
+	if got := len(o.Store.Tasks); got != 2 {
+		t.Errorf("stored tasks = %d, want 2", got)
+	}
+}
+
+func TestBusyAgentStaysLive(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	poll(o.Store, "multiplier", "*", "")
+	o.Store.Mu.Lock()
+	seen := o.Store.agents["multiplier"]
+	seen.lastSeen = time.Now().Add(-agentStaleAfter)
+	o.Store.agents["multiplier"] = seen
+	o.Store.Mu.Unlock()
+
+	// A busy agent does not poll, but it asks for dependency results.
+	req := httptest.NewRequest(http.MethodGet, "/internal/task/result/task-expr-9-0", nil)
+	req.Header.Set(models.AgentIDHeader, "multiplier")
+	handleGetTaskResult(httptest.NewRecorder(), req, o.Store)
+
+	poll(o.Store, "adder", "+", "")
+	expr, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "2*3"}, "")
+	if err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+	if got, _ := o.Store.GetExpression(expr.Id); got.UnroutableTasks != 0 {
+		t.Errorf("unroutable_tasks = %d, want 0 while the multiplier reports in", got.UnroutableTasks)
+	}
+}
@@ -0,0 +1,112 @@
+package orchestrator
+
+import (
+	"fmt"
+
+	"github.com/pAran0k/calc_go/models"
+)
+
+// fairQueue implements start-time fair queuing over flows. A flow is the
+// expressions of one owner in one priority class, or a single expression
+// when there is no owner. Every dispatch advances the flow's virtual time by
+// 1/weight, and the ready task whose flow is furthest behind goes next, so a
+// large expression cannot starve the others and higher classes get
+// proportionally more agents.
+type fairQueue struct {
+	virtualTime float64
+	flows       map[string]float64
+}
+
+// maxIdleFlows bounds how many flows are tracked before those that have
+// fallen behind the virtual time, and thus carry no state worth keeping, are
+// dropped.
+const maxIdleFlows = 64
+
+func newFairQueue() *fairQueue {
+	return &fairQueue{flows: make(map[string]float64)}
+}
+
+func (q *fairQueue) start(flow string) float64 {
+	return max(q.flows[flow], q.virtualTime)
+}
+
+func (q *fairQueue) charge(flow string, weight float64) {
+	start := q.start(flow)
+	q.flows[flow] = start + 1/weight
+	q.virtualTime = start
+	if len(q.flows) > maxIdleFlows {
+		for f, finish := range q.flows {
+			if finish <= q.virtualTime {
+				delete(q.flows, f)
+			}
+		}
+	}
+}
+
+type scheduleKey struct {
+	flow   string
+	start  float64
+	weight float64
+	rank   int
+}
+
+// before orders candidates: the flow furthest behind first, then the higher
+// class, then the task with the longest chain of dependants above it, which
+// lies on the critical path of its expression.
+func (k scheduleKey) before(other scheduleKey) bool {
+	if k.start != other.start {
+		return k.start < other.start
+	}
+	if k.weight != other.weight {
+		return k.weight > other.weight
+	}
+	return k.rank > other.rank
+}
+
+// scheduleKey places a task in the flow of the most important expression
+// that waits for it. Callers hold s.Mu.
+func (s *Store) scheduleKey(task models.Task) scheduleKey {
+	var owner models.Expression
+	found := false
+	for _, id := range s.taskExprs[task.ID] {
+		expr, exists := s.Expressions[id]
+		if !exists {
+			continue
+		}
+		if !found || expr.Priority.Weight() > owner.Priority.Weight() {
+			owner, found = expr, true
+		}
+	}
+
+	flow := owner.Owner
+	if flow == "" {
+		flow = fmt.Sprintf("expr-%d", owner.Id)
+	}
+	flow += "/" + string(owner.Priority)
+	return scheduleKey{
+		flow:   flow,
+		start:  s.fair.start(flow),
+		weight: owner.Priority.Weight(),
+		rank:   s.taskRank[task.ID],
+	}
+}
+
+// rankTasks returns, for each task, the length of the longest chain of tasks
+// between it and a root. Tasks fresh from BuildTasks come users first and
+// settle in one pass; a restored snapshot may need a few more.
+func rankTasks(tasks []models.Task) map[string]int {
+	ranks := make(map[string]int, len(tasks))
+	for changed := true; changed; {
+		changed = false
+		for _, task := range tasks {
+			for _, arg := range []string{task.Arg1, task.Arg2} {
+				if isNumeric(arg) || ranks[arg] > ranks[task.ID] {
+					continue
+				}
+				ranks[arg] = ranks[task.ID] + 1
+				changed = true
+			}
+		}
+	}
+	return ranks
+}
@@ -0,0 +1,77 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+)
+
+func addLeafTasks(st *Store, expr models.Expression, count int) {
+	st.AddExpression(expr)
+	tasks := make([]models.Task, count)
+	for i := range tasks {
+		tasks[i] = models.Task{ID: fmt.Sprintf("task-expr-%d-%d", expr.Id, i), Arg1: "1", Arg2: fmt.Sprint(i), Operation: "+"}
+	}
+	st.AddExpressionTasks(expr.Id, tasks)
+}
+
+func dispatchOwners(t *testing.T, st *Store, n int) map[int]int {
+	t.Helper()
+	counts := make(map[int]int)
+	for i := 0; i < n; i++ {
+		task, ok := st.GetPendingTask()
+		if !ok {
+			t.Fatalf("GetPendingTask() returned no task after %d dispatches", i)
+		}
+		counts[st.taskExprs[task.ID][0]]++
+	}
+	return counts
+}
+
+func TestSchedulerSharesAgentsAcrossExpressions(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	addLeafTasks(st, models.Expression{Id: 1, Status: models.StatusProcessing, Priority: models.PriorityNormal}, 20)
+	addLeafTasks(st, models.Expression{Id: 2, Status: models.StatusProcessing, Priority: models.PriorityNormal}, 3)
+
+	if counts := dispatchOwners(t, st, 6); counts[1] != 3 || counts[2] != 3 {
+		t.Errorf("dispatches per expression = %v, want 3 each", counts)
+	}
+}
+
+func TestSchedulerWeightsPriorityClasses(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	addLeafTasks(st, models.Expression{Id: 1, Status: models.StatusProcessing, Priority: models.PriorityLow, Owner: "batch"}, 20)
+	addLeafTasks(st, models.Expression{Id: 2, Status: models.StatusProcessing, Priority: models.PriorityHigh, Owner: "web"}, 20)
+
+	if counts := dispatchOwners(t, st, 10); counts[2] != 8 || counts[1] != 2 {
+		t.Errorf("dispatches per expression = %v, want 8 high and 2 low", counts)
+	}
+}
+
+func TestSchedulerPrefersCriticalPath(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	// 4*5 is queued first, but 1+2 heads the longer chain to the root.
+	expr, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "4*5+(1+2)*3"}, "")
+	if err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+
+	task, ok := o.Store.GetPendingTask()
+	if !ok || task.Arg1 != "1.000000" || task.Operation != "+" {
+		t.Errorf("first dispatched task of expression %d = %+v, want 1+2", expr.Id, task)
+	}
+}
+
+func TestCalculateRejectsUnknownPriority(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	if rec := calculate(o, "/api/v1/calculate", `{"expression": "1+1", "priority": "urgent"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("calculate with unknown priority = %d, want 422", rec.Code)
+	}
+	if rec := calculate(o, "/api/v1/calculate", `{"expression": "1+1", "priority": "low"}`); rec.Code != http.StatusCreated {
+		t.Errorf("calculate with low priority = %d, want 201", rec.Code)
+	}
+}
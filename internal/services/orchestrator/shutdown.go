@@ -0,0 +1,104 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// PauseDispatch stops handing out tasks; results for tasks already dispatched
+// are still accepted.
+func (s *Store) PauseDispatch() {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.dispatchPaused = true
+}
+
+// InFlightTasks counts tasks handed to agents whose results have not arrived.
+func (s *Store) InFlightTasks() int {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	for taskID := range s.dispatched {
+		if task, exists := s.Tasks[taskID]; !exists || task.Completed {
+			delete(s.dispatched, taskID)
+		}
+	}
+	return len(s.dispatched)
+}
+
+func (s *Store) WaitInFlight(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for s.InFlightTasks() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// shutdown refuses new expressions, optionally lets agents finish what they
+// hold, stops the HTTP server and writes the store snapshot, all within
+// ShutdownTimeout. cancelRequests ends long-lived requests such as event
+// streams so that the server can close.
+func (o *Orchestrator) shutdown(cancelRequests context.CancelFunc) error {
+	slog.Info("orchestrator stopping", "timeout", o.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), o.ShutdownTimeout)
+	defer cancel()
+
+	o.shuttingDown.Store(true)
+	o.Store.PauseDispatch()
+	if o.ShutdownWaitTasks {
+		if err := o.Store.WaitInFlight(ctx); err != nil {
+			slog.Warn("shutdown deadline reached with tasks in flight", "tasks", o.Store.InFlightTasks())
+		}
+	}
+
+	cancelRequests()
+	err := o.Server.Shutdown(ctx)
+	// A follower's store is a copy of the shared snapshot; writing it back
+	// could overwrite newer state from the leader.
+	if o.SnapshotPath != "" && o.IsLeader() {
+		snap := o.Store.Snapshot()
+		if serr := SaveSnapshot(o.SnapshotPath, snap); serr != nil {
+			slog.Error("snapshot write failed", "path", o.SnapshotPath, "error", serr)
+			err = errors.Join(err, serr)
+		} else {
+			slog.Info("snapshot written", "path", o.SnapshotPath, "expressions", len(snap.Expressions), "tasks", len(snap.Tasks))
+		}
+	}
+	return err
+}
+
+func (o *Orchestrator) restoreSnapshot() {
+	snap, err := LoadSnapshot(o.SnapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err == nil {
+		err = o.Store.Restore(snap)
+	}
+	if err != nil {
+		slog.Error("snapshot restore failed", "path", o.SnapshotPath, "error", err)
+		return
+	}
+
+	o.resumeExpressions(snap)
+	slog.Info("snapshot restored", "path", o.SnapshotPath, "expressions", len(snap.Expressions), "tasks", len(snap.Tasks), "taken_at", snap.TakenAt)
+}
+
+// resumeExpressions continues expression ids after those in snap and watches
+// the deadlines of its unfinished expressions.
+func (o *Orchestrator) resumeExpressions(snap Snapshot) {
+	for _, expr := range snap.Expressions {
+		if id := uint64(expr.Id); id > atomic.LoadUint64(&o.taskCounter) {
+			atomic.StoreUint64(&o.taskCounter, id)
+		}
+		o.watchDeadline(expr)
+	}
+}
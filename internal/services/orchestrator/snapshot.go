@@ -0,0 +1,161 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pAran0k/calc_go/models"
+)
+
+const snapshotVersion = 1
+
+// Snapshot is the on-disk form of the store written on shutdown. Caches,
+// traces and webhook deliveries are not part of it.
+type Snapshot struct {
+	Version         int                 `json:"version"`
+	TakenAt         time.Time           `json:"taken_at"`
+	Expressions     []models.Expression `json:"expressions"`
+	Tasks           []models.Task       `json:"tasks"`
+	ExpressionTasks map[int][]string    `json:"expression_tasks"`
+	// OperationCosts is absent in snapshots taken before the cost table
+	// became editable; the configured costs are kept then.
+	OperationCosts *models.OperationCosts `json:"operation_costs,omitempty"`
+}
+
+func (s *Store) Snapshot() Snapshot {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	costs := s.costs
+	snap := Snapshot{
+		Version:         snapshotVersion,
+		TakenAt:         time.Now(),
+		Expressions:     make([]models.Expression, 0, len(s.Expressions)),
+		Tasks:           make([]models.Task, 0, len(s.Tasks)),
+		ExpressionTasks: make(map[int][]string, len(s.exprTasks)),
+		OperationCosts:  &costs,
+	}
+	for _, expr := range s.Expressions {
+		snap.Expressions = append(snap.Expressions, expr)
+	}
+	for _, task := range s.Tasks {
+		snap.Tasks = append(snap.Tasks, task)
+	}
+	for id, taskIDs := range s.exprTasks {
+		snap.ExpressionTasks[id] = append([]string(nil), taskIDs...)
+	}
+	sort.Slice(snap.Expressions, func(i, j int) bool { return snap.Expressions[i].Id < snap.Expressions[j].Id })
+	sort.Slice(snap.Tasks, func(i, j int) bool { return snap.Tasks[i].ID < snap.Tasks[j].ID })
+	return snap
+}
+
+// Restore loads a snapshot into an empty store. Unfinished tasks go back to
+// the queue, including those that were dispatched when the snapshot was taken:
+// their agents reported to the previous process.
+func (s *Store) Restore(snap Snapshot) error {
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.restore(snap)
+	return nil
+}
+
+// Replace swaps the expressions and tasks of the store for those of snap,
+// which is how a replica picks up the state its leader keeps in the shared
+// snapshot. Finish hooks do not fire for expressions that finished elsewhere.
+func (s *Store) Replace(snap Snapshot) error {
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	clear(s.Expressions)
+	clear(s.Tasks)
+	s.PendingTasks = nil
+	clear(s.exprTasks)
+	clear(s.taskExprs)
+	clear(s.inflight)
+	clear(s.finishedAt)
+	clear(s.dispatched)
+	s.restore(snap)
+	return nil
+}
+
+// restore loads snap into the cleared store. Callers hold s.Mu.
+func (s *Store) restore(snap Snapshot) {
+	if snap.OperationCosts != nil {
+		s.costs = *snap.OperationCosts
+	}
+	for _, expr := range snap.Expressions {
+		s.Expressions[expr.Id] = expr
+		if expr.FinishedAt != nil {
+			s.finishedAt[expr.Id] = *expr.FinishedAt
+		}
+	}
+	for id, taskIDs := range snap.ExpressionTasks {
+		s.exprTasks[id] = append([]string(nil), taskIDs...)
+		for _, taskID := range taskIDs {
+			s.taskExprs[taskID] = append(s.taskExprs[taskID], id)
+		}
+	}
+
+	s.taskRank = rankTasks(snap.Tasks)
+	for _, task := range snap.Tasks {
+		s.Tasks[task.ID] = task
+		if task.Completed {
+			continue
+		}
+		if task.Hash != "" {
+			s.inflight[task.Hash] = task.ID
+		}
+		s.PendingTasks = append(s.PendingTasks, task)
+	}
+}
+
+// SaveSnapshot writes the snapshot atomically so that a crash mid-write never
+// leaves a truncated file behind.
+func SaveSnapshot(path string, snap Snapshot) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(snap); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func LoadSnapshot(path string) (Snapshot, error) {
+	var snap Snapshot
+	file, err := os.Open(path)
+	if err != nil {
+		return snap, err
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&snap); err != nil {
+		return snap, fmt.Errorf("decode snapshot %s: %w", path, err)
+	}
+	return snap, nil
+}
@@ -0,0 +1,98 @@
+package orchestrator
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+)
+
+func TestShutdownSnapshotRestore(t *testing.T) {
+	config := env.DefaultOrchestratorConfig()
+	config.SnapshotPath = filepath.Join(t.TempDir(), "snapshot.json")
+
+	o := NewOrchestrator(config)
+	expr, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "(1+2)*(3+4)"}, "")
+	if err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+	task, ok := o.Store.GetPendingTask()
+	if !ok {
+		t.Fatal("GetPendingTask() returned no task")
+	}
+	o.Store.UpdateTask(models.Result{TaskID: task.ID, Value: 3}, "")
+	if _, ok := o.Store.GetPendingTask(); !ok {
+		t.Fatal("GetPendingTask() returned no second task")
+	}
+
+	if err := o.shutdown(func() {}); err != nil {
+		t.Fatalf("shutdown unexpected error: %v", err)
+	}
+	if rec := calculate(o, "/api/v1/calculate", `{"expression": "1+1"}`); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("calculate after shutdown = %d, want 503", rec.Code)
+	}
+
+	restored := NewOrchestrator(config)
+	got, exists := restored.Store.GetExpression(expr.Id)
+	if !exists || got.Status != models.StatusProcessing {
+		t.Fatalf("restored expression = %+v, %v, want processing", got, exists)
+	}
+
+	// 3+4 was dispatched before shutdown and is queued again; the product is
+	// handed out once it completes.
+	for _, want := range []struct {
+		operation string
+		value     float64
+	}{{"+", 7}, {"*", 21}} {
+		task, ok := restored.Store.GetPendingTask()
+		if !ok || task.Operation != want.operation {
+			t.Fatalf("GetPendingTask() = %+v, %v, want %s task", task, ok, want.operation)
+		}
+		restored.Store.UpdateTask(models.Result{TaskID: task.ID, Value: want.value}, "")
+	}
+	got, _ = restored.Store.GetExpression(expr.Id)
+	if got.Status != models.StatusCompleted || got.Result != 21 {
+		t.Errorf("restored expression = %s %f, want completed 21", got.Status, got.Result)
+	}
+
+	next, err := restored.submitExpression(context.Background(), CalculateRequest{Expression: "5"}, "")
+	if err != nil || next.Id != expr.Id+1 {
+		t.Errorf("next expression id = %d, %v, want %d", next.Id, err, expr.Id+1)
+	}
+}
+
+func TestShutdownWaitsForInFlightTasks(t *testing.T) {
+	o := NewOrchestrator(env.DefaultOrchestratorConfig())
+	o.ShutdownWaitTasks = true
+	o.ShutdownTimeout = 2 * time.Second
+	if _, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "2+2"}, ""); err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+	task, ok := o.Store.GetPendingTask()
+	if !ok {
+		t.Fatal("GetPendingTask() returned no task")
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		o.Store.UpdateTask(models.Result{TaskID: task.ID, Value: 4}, "")
+	}()
+
+	start := time.Now()
+	if err := o.shutdown(func() {}); err != nil {
+		t.Fatalf("shutdown unexpected error: %v", err)
+	}
+	if n := o.Store.InFlightTasks(); n != 0 {
+		t.Errorf("InFlightTasks() after shutdown = %d, want 0", n)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("shutdown took %s, want to wait for the in-flight task only", elapsed)
+	}
+	if _, ok := o.Store.GetPendingTask(); ok {
+		t.Error("tasks must not be dispatched during shutdown")
+	}
+}
@@ -0,0 +1,79 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/pAran0k/calc_go/pkg/logging"
+)
+
+const sseKeepAlive = 15 * time.Second
+
+func (o *Orchestrator) handleExpressionEvents(w http.ResponseWriter, r *http.Request, id int, version int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := o.Store.Events.Subscribe(id)
+	defer unsubscribe()
+
+	expr, exists := o.Store.GetExpression(id)
+	if !exists {
+		http.Error(w, "Expression not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if expr.Status.IsFinal() {
+		writeEvent(w, Event{Type: EventExpressionFinished, ExpressionID: id, Error: expr.Error, Expression: &expr}, version)
+		flusher.Flush()
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			slog.Debug("event stream client disconnected", logging.KeyExprID, id)
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event := <-events:
+			writeEvent(w, event, version)
+			flusher.Flush()
+			if event.Type == EventExpressionFinished {
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event Event, version int) {
+	payload := struct {
+		Event
+		Expression any `json:"expression,omitempty"`
+	}{Event: event}
+	if event.Expression != nil {
+		payload.Expression = presentExpression(*event.Expression, version)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("event encoding failed", "event", event.Type, "error", err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
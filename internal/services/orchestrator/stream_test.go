@@ -0,0 +1,74 @@
+package orchestrator
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+)
+
+func TestExpressionEventsStream(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	node := &models.Node{Value: "+", Left: &models.Node{Value: "1"}, Right: &models.Node{Value: "2"}}
+	o.Store.AddExpression(models.Expression{Id: 1, Status: models.StatusProcessing, Node: node})
+	o.Store.AddExpressionTasks(1, []models.Task{{ID: "task-expr-1-0", Arg1: "1", Arg2: "2", Operation: "+", Hash: "h"}})
+
+	server := httptest.NewServer(http.HandlerFunc(o.handleExpressionByID))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v2/expressions/1/events")
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		o.Store.GetPendingTask()
+		o.Store.UpdateTask(models.Result{TaskID: "task-expr-1-0", Value: 3}, "")
+	}()
+
+	var types []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			types = append(types, name)
+		}
+		if strings.HasPrefix(line, "data: ") && strings.Contains(line, `"status":"completed"`) {
+			break
+		}
+	}
+
+	want := []string{EventTaskDispatched, EventTaskCompleted, EventExpressionFinished}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", types, want)
+	}
+}
+
+func TestHubKeepsFinishedEventForSlowSubscriber(t *testing.T) {
+	hub := NewHub()
+	events, unsubscribe := hub.Subscribe(1)
+	defer unsubscribe()
+
+	for i := 0; i < subscriberBuffer*2; i++ {
+		hub.Publish(Event{Type: EventTaskCompleted, ExpressionID: 1})
+	}
+	hub.Publish(Event{Type: EventExpressionFinished, ExpressionID: 1})
+
+	var last Event
+	for len(events) > 0 {
+		last = <-events
+	}
+	if last.Type != EventExpressionFinished {
+		t.Errorf("last buffered event = %q, want %q", last.Type, EventExpressionFinished)
+	}
+}
@@ -0,0 +1,290 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/pAran0k/calc_go/models"
+)
+
+type TaskTrace struct {
+	TaskID       string        `json:"task_id"`
+	Operation    string        `json:"operation"`
+	DependsOn    []string      `json:"depends_on,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+	ReadyAt      *time.Time    `json:"ready_at,omitempty"`
+	DispatchedAt *time.Time    `json:"dispatched_at,omitempty"`
+	CompletedAt  *time.Time    `json:"completed_at,omitempty"`
+	Agent        string        `json:"agent,omitempty"`
+	Worker       string        `json:"worker,omitempty"`
+	Dispatches   int           `json:"dispatches"`
+	Releases     int           `json:"releases,omitempty"`
+	Retries      int           `json:"retries"`
+	Duration     time.Duration `json:"duration_ns,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	CriticalPath bool          `json:"critical_path"`
+	// refs counts the expressions whose trace includes the task.
+	refs int
+}
+
+type ExpressionTrace struct {
+	ExpressionID int           `json:"expression_id"`
+	CreatedAt    time.Time     `json:"created_at"`
+	FinishedAt   *time.Time    `json:"finished_at,omitempty"`
+	Duration     time.Duration `json:"duration_ns,omitempty"`
+	Tasks        []TaskTrace   `json:"tasks"`
+	CriticalPath []string      `json:"critical_path"`
+}
+
+func (s *Store) traceCreated(exprID int, task models.Task) {
+	trace := &TaskTrace{TaskID: task.ID, Operation: task.Operation, CreatedAt: time.Now()}
+	for _, arg := range []string{task.Arg1, task.Arg2} {
+		if !isNumeric(arg) {
+			trace.DependsOn = append(trace.DependsOn, arg)
+		}
+	}
+	s.taskTraces[task.ID] = trace
+	s.traceLinked(exprID, task.ID)
+}
+
+func (s *Store) traceLinked(exprID int, taskID string) {
+	trace, ok := s.taskTraces[taskID]
+	if !ok {
+		return
+	}
+	for _, existing := range s.exprTraces[exprID] {
+		if existing == trace {
+			return
+		}
+	}
+	s.exprTraces[exprID] = append(s.exprTraces[exprID], trace)
+	trace.refs++
+	for _, dep := range trace.DependsOn {
+		s.traceLinked(exprID, dep)
+	}
+}
+
+func (s *Store) RecordDispatch(taskID, agent, worker string) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	trace, ok := s.taskTraces[taskID]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	trace.DispatchedAt = &now
+	trace.Agent = agent
+	trace.Worker = worker
+	trace.Dispatches++
+}
+
+func (s *Store) traceReleased(taskID string) {
+	trace, ok := s.taskTraces[taskID]
+	if !ok {
+		return
+	}
+	trace.DispatchedAt = nil
+	trace.Agent = ""
+	trace.Worker = ""
+	trace.Releases++
+}
+
+func (s *Store) traceCompleted(result models.Result) {
+	trace, ok := s.taskTraces[result.TaskID]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	trace.CompletedAt = &now
+	trace.Error = result.Error
+	trace.Retries = max(trace.Dispatches-1, 0) + max(result.Attempts-1, 0)
+	if trace.DispatchedAt != nil {
+		trace.Duration = now.Sub(*trace.DispatchedAt)
+	}
+}
+
+func (s *Store) forgetTraces(exprID int) {
+	for _, trace := range s.exprTraces[exprID] {
+		if trace.refs--; trace.refs == 0 {
+			delete(s.taskTraces, trace.TaskID)
+		}
+	}
+	delete(s.exprTraces, exprID)
+}
+
+func (s *Store) GetTrace(exprID int) (ExpressionTrace, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	expr, exists := s.Expressions[exprID]
+	if !exists {
+		return ExpressionTrace{}, ErrExpressionNotFound
+	}
+
+	trace := ExpressionTrace{
+		ExpressionID: exprID,
+		CreatedAt:    expr.CreatedAt,
+		FinishedAt:   expr.FinishedAt,
+		Tasks:        []TaskTrace{},
+		CriticalPath: []string{},
+	}
+	if expr.FinishedAt != nil {
+		trace.Duration = expr.FinishedAt.Sub(expr.CreatedAt)
+	}
+
+	byID := make(map[string]TaskTrace)
+	dependents := make(map[string]int)
+	for _, t := range s.exprTraces[exprID] {
+		task := *t
+		task.ReadyAt = readyTime(t, s.taskTraces)
+		byID[task.TaskID] = task
+		for _, dep := range task.DependsOn {
+			dependents[dep]++
+		}
+	}
+
+	var root string
+	for id, task := range byID {
+		if dependents[id] == 0 && (root == "" || completedAfter(task, byID[root])) {
+			root = id
+		}
+	}
+	for id := root; id != ""; {
+		trace.CriticalPath = append([]string{id}, trace.CriticalPath...)
+		task := byID[id]
+		task.CriticalPath = true
+		byID[id] = task
+
+		id = ""
+		for _, dep := range task.DependsOn {
+			if _, ok := byID[dep]; ok && (id == "" || completedAfter(byID[dep], byID[id])) {
+				id = dep
+			}
+		}
+	}
+
+	for _, task := range byID {
+		trace.Tasks = append(trace.Tasks, task)
+	}
+	sort.Slice(trace.Tasks, func(i, j int) bool {
+		return trace.Tasks[i].CreatedAt.Before(trace.Tasks[j].CreatedAt) ||
+			trace.Tasks[i].CreatedAt.Equal(trace.Tasks[j].CreatedAt) && trace.Tasks[i].TaskID < trace.Tasks[j].TaskID
+	})
+	return trace, nil
+}
+
+func readyTime(task *TaskTrace, traces map[string]*TaskTrace) *time.Time {
+	ready := task.CreatedAt
+	for _, dep := range task.DependsOn {
+		depTrace, ok := traces[dep]
+		if !ok || depTrace.CompletedAt == nil {
+			return nil
+		}
+		if depTrace.CompletedAt.After(ready) {
+			ready = *depTrace.CompletedAt
+		}
+	}
+	return &ready
+}
+
+func completedAfter(a, b TaskTrace) bool {
+	if a.CompletedAt == nil || b.CompletedAt == nil {
+		return a.CompletedAt == nil && b.CompletedAt != nil
+	}
+	return a.CompletedAt.After(*b.CompletedAt)
+}
+
+type chromeEvent struct {
+	Name      string         `json:"name"`
+	Category  string         `json:"cat,omitempty"`
+	Phase     string         `json:"ph"`
+	Timestamp int64          `json:"ts"`
+	Duration  int64          `json:"dur,omitempty"`
+	PID       int            `json:"pid"`
+	TID       int            `json:"tid"`
+	Args      map[string]any `json:"args,omitempty"`
+}
+
+func (t ExpressionTrace) ChromeEvents() []chromeEvent {
+	events := []chromeEvent{{
+		Name:  "process_name",
+		Phase: "M",
+		PID:   t.ExpressionID,
+		Args:  map[string]any{"name": fmt.Sprintf("expression %d", t.ExpressionID)},
+	}}
+
+	threads := map[string]int{"orchestrator": 0}
+	events = append(events, chromeEvent{Name: "thread_name", Phase: "M", PID: t.ExpressionID, TID: 0, Args: map[string]any{"name": "orchestrator"}})
+	for _, task := range t.Tasks {
+		lane := "orchestrator"
+		if task.Agent != "" {
+			lane = task.Agent + "/" + task.Worker
+		}
+		tid, ok := threads[lane]
+		if !ok {
+			tid = len(threads)
+			threads[lane] = tid
+			events = append(events, chromeEvent{Name: "thread_name", Phase: "M", PID: t.ExpressionID, TID: tid, Args: map[string]any{"name": lane}})
+		}
+
+		start, end := task.CreatedAt, task.CreatedAt
+		if task.DispatchedAt != nil {
+			start = *task.DispatchedAt
+		}
+		if task.CompletedAt != nil {
+			end = *task.CompletedAt
+		}
+		category := "task"
+		if task.CriticalPath {
+			category = "task,critical_path"
+		}
+		events = append(events, chromeEvent{
+			Name:      task.TaskID + " " + task.Operation,
+			Category:  category,
+			Phase:     "X",
+			Timestamp: start.UnixMicro(),
+			Duration:  max(end.Sub(start).Microseconds(), 1),
+			PID:       t.ExpressionID,
+			TID:       tid,
+			Args: map[string]any{
+				"retries":       task.Retries,
+				"critical_path": task.CriticalPath,
+				"error":         task.Error,
+			},
+		})
+	}
+	return events
+}
+
+func (o *Orchestrator) handleTrace(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "timeline" && format != "chrome" {
+		http.Error(w, "Unsupported trace format", http.StatusBadRequest)
+		return
+	}
+
+	trace, err := o.Store.GetTrace(id)
+	if err != nil {
+		http.Error(w, "Expression not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if format != "chrome" {
+		json.NewEncoder(w).Encode(trace)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=expression-%d-trace.json", id))
+	json.NewEncoder(w).Encode(struct {
+		TraceEvents     []chromeEvent `json:"traceEvents"`
+		DisplayTimeUnit string        `json:"displayTimeUnit"`
+	}{TraceEvents: trace.ChromeEvents(), DisplayTimeUnit: "ms"})
+}
@@ -0,0 +1,90 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+)
+
+func TestExpressionTrace(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	expr, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "(1+2)*(3+4)"}, "")
+	if err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+
+	for {
+		task, ok := o.Store.GetPendingTask()
+		if !ok {
+			break
+		}
+		o.Store.RecordDispatch(task.ID, "agent-1", "0")
+		o.Store.UpdateTask(models.Result{TaskID: task.ID, Value: 1, Attempts: 2}, "")
+	}
+
+	trace, err := o.Store.GetTrace(expr.Id)
+	if err != nil {
+		t.Fatalf("GetTrace unexpected error: %v", err)
+	}
+	if len(trace.Tasks) != 3 {
+		t.Fatalf("trace has %d tasks, want 3", len(trace.Tasks))
+	}
+	if len(trace.CriticalPath) != 2 || trace.CriticalPath[1] != "task-expr-1-2" {
+		t.Errorf("critical path = %v, want a leaf followed by the root task", trace.CriticalPath)
+	}
+	for _, task := range trace.Tasks {
+		if task.Agent != "agent-1" || task.Retries != 1 || task.ReadyAt == nil {
+			t.Errorf("task trace = %+v, want agent-1 with 1 retry and ready time", task)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	o.handleExpressionByID(rec, httptest.NewRequest(http.MethodGet, "/api/v1/expressions/1/trace?format=chrome", nil))
+	var chrome struct {
+		TraceEvents []chromeEvent `json:"traceEvents"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&chrome); err != nil {
+		t.Fatalf("decode chrome trace: %v", err)
+	}
+	spans := 0
+	for _, event := range chrome.TraceEvents {
+		if event.Phase == "X" {
+			spans++
+		}
+	}
+	if spans != 3 {
+		t.Errorf("chrome trace has %d spans, want 3", spans)
+	}
+
+	rec = httptest.NewRecorder()
+	o.handleExpressionByID(rec, httptest.NewRequest(http.MethodGet, "/api/v1/expressions/1/trace?format=svg", nil))
+	if ct := rec.Header().Get("Content-Type"); rec.Code != http.StatusBadRequest || strings.HasPrefix(ct, "application/json") {
+		t.Errorf("unsupported format = %d with Content-Type %q, want a plain-text 400", rec.Code, ct)
+	}
+}
+
+func TestForgetTracesKeepsSharedTasks(t *testing.T) {
+	st := NewStore(env.DefaultOrchestratorConfig())
+	shared := models.Task{ID: "task-expr-1-0", Arg1: "2", Arg2: "3", Operation: "*", Hash: "shared"}
+	st.AddExpression(models.Expression{Id: 1, Status: models.StatusProcessing})
+	st.AddExpressionTasks(1, []models.Task{shared})
+	st.AddExpression(models.Expression{Id: 2, Status: models.StatusProcessing})
+	second := shared
+	second.ID = "task-expr-2-0"
+	st.AddExpressionTasks(2, []models.Task{second})
+
+	st.forgetTraces(1)
+	if _, ok := st.taskTraces[shared.ID]; !ok {
+		t.Fatal("trace of a task shared with expression 2 was dropped")
+	}
+	st.forgetTraces(2)
+	if len(st.taskTraces) != 0 {
+		t.Errorf("traces left after both expressions were forgotten: %d", len(st.taskTraces))
+	}
+}
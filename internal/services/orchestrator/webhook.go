@@ -0,0 +1,308 @@
+package orchestrator
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pAran0k/calc_go/models"
+	"github.com/pAran0k/calc_go/pkg/logging"
+)
+
+const (
+	SignatureHeader = "X-Calc-Signature"
+	DeliveryHeader  = "X-Calc-Delivery"
+)
+
+type DeliveryAttempt struct {
+	DeliveryID string        `json:"delivery_id"`
+	Attempt    int           `json:"attempt"`
+	Time       time.Time     `json:"time"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration_ns"`
+}
+
+type DeadLetter struct {
+	ID           string          `json:"id"`
+	ExpressionID int             `json:"expression_id"`
+	URL          string          `json:"url"`
+	Payload      json.RawMessage `json:"payload"`
+	LastError    string          `json:"last_error"`
+	FailedAt     time.Time       `json:"failed_at"`
+}
+
+type webhookPayload struct {
+	Event      string            `json:"event"`
+	Expression models.Expression `json:"expression"`
+}
+
+type Notifier struct {
+	Client      *http.Client
+	Secret      []byte
+	MaxAttempts int
+	Backoff     time.Duration
+	// AllowPrivateTargets lets callbacks reach loopback, private and
+	// link-local addresses, for receivers deployed next to the orchestrator.
+	AllowPrivateTargets bool
+
+	mu          sync.Mutex
+	counter     int
+	deliveries  map[int][]DeliveryAttempt
+	deadLetters map[string]DeadLetter
+}
+
+func NewNotifier(secret string, maxAttempts int, backoff time.Duration) *Notifier {
+	n := &Notifier{
+		Secret:      []byte(secret),
+		MaxAttempts: max(maxAttempts, 1),
+		Backoff:     backoff,
+		deliveries:  make(map[int][]DeliveryAttempt),
+		deadLetters: make(map[string]DeadLetter),
+	}
+	// The address is checked after DNS resolution, on every connection
+	// including redirects, so a public name cannot point the orchestrator at
+	// its own network.
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if n.AllowPrivateTargets {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenCallbackTarget, host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	n.Client = &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	return n
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which net.IP does not
+// count as private.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func ValidateCallbackURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid callback_url: %s", raw)
+	}
+	return nil
+}
+
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (n *Notifier) Notify(expr models.Expression) {
+	if expr.CallbackURL == "" {
+		return
+	}
+	payload, err := json.Marshal(webhookPayload{Event: "expression.finished", Expression: expr})
+	if err != nil {
+		slog.Error("webhook payload encoding failed", logging.KeyExprID, expr.Id, "error", err)
+		return
+	}
+	n.deliver(n.nextDeliveryID(), expr.Id, expr.CallbackURL, payload)
+}
+
+func (n *Notifier) nextDeliveryID() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.counter++
+	return "delivery-" + strconv.Itoa(n.counter)
+}
+
+func (n *Notifier) deliver(deliveryID string, exprID int, target string, payload []byte) bool {
+	backoff := n.Backoff
+	var lastErr string
+	for attempt := 1; attempt <= n.MaxAttempts; attempt++ {
+		record := DeliveryAttempt{DeliveryID: deliveryID, Attempt: attempt, Time: time.Now()}
+		statusCode, err := n.post(deliveryID, target, payload)
+		record.Duration = time.Since(record.Time)
+		record.StatusCode = statusCode
+		if err != nil {
+			record.Error = err.Error()
+			lastErr = record.Error
+		}
+		n.record(exprID, record)
+
+		if err == nil {
+			slog.Info("webhook delivered", logging.KeyExprID, exprID, "delivery_id", deliveryID, "url", target)
+			return true
+		}
+		slog.Warn("webhook delivery failed", logging.KeyExprID, exprID, "delivery_id", deliveryID, "attempt", attempt, "error", err)
+		if attempt < n.MaxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	n.mu.Lock()
+	n.deadLetters[deliveryID] = DeadLetter{
+		ID:           deliveryID,
+		ExpressionID: exprID,
+		URL:          target,
+		Payload:      payload,
+		LastError:    lastErr,
+		FailedAt:     time.Now(),
+	}
+	n.mu.Unlock()
+	slog.Error("webhook moved to dead letters", logging.KeyExprID, exprID, "delivery_id", deliveryID)
+	return false
+}
+
+func (n *Notifier) post(deliveryID, target string, payload []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(SignatureHeader, Sign(n.Secret, payload))
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (n *Notifier) record(exprID int, attempt DeliveryAttempt) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.deliveries[exprID] = append(n.deliveries[exprID], attempt)
+}
+
+func (n *Notifier) Deliveries(exprID int) []DeliveryAttempt {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]DeliveryAttempt{}, n.deliveries[exprID]...)
+}
+
+func (n *Notifier) DeadLetters() []DeadLetter {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	letters := make([]DeadLetter, 0, len(n.deadLetters))
+	for _, letter := range n.deadLetters {
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i].FailedAt.Before(letters[j].FailedAt) })
+	return letters
+}
+
+// Replay takes a letter off the dead-letter list and delivers it again in the
+// background; the channel receives the outcome.
+func (n *Notifier) Replay(deliveryID string) (<-chan bool, error) {
+	n.mu.Lock()
+	letter, exists := n.deadLetters[deliveryID]
+	delete(n.deadLetters, deliveryID)
+	n.mu.Unlock()
+	if !exists {
+		return nil, ErrDeliveryNotFound
+	}
+	done := make(chan bool, 1)
+	go func() {
+		done <- n.deliver(letter.ID, letter.ExpressionID, letter.URL, letter.Payload)
+	}()
+	return done, nil
+}
+
+// Forget drops the delivery log and dead letters of a deleted expression.
+func (n *Notifier) Forget(exprID int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.deliveries, exprID)
+	for id, letter := range n.deadLetters {
+		if letter.ExpressionID == exprID {
+			delete(n.deadLetters, id)
+		}
+	}
+}
+
+func (o *Orchestrator) handleDeliveries(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, exists := o.Store.GetExpression(id); !exists {
+		http.Error(w, "Expression not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Deliveries []DeliveryAttempt `json:"deliveries"`
+	}{Deliveries: o.Webhooks.Deliveries(id)})
+}
+
+func (o *Orchestrator) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		DeadLetters []DeadLetter `json:"dead_letters"`
+	}{DeadLetters: o.Webhooks.DeadLetters()})
+}
+
+func (o *Orchestrator) handleReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deliveryID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/webhooks/dead-letters/"), "/")
+	if deliveryID == "" || action != "replay" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := o.Webhooks.Replay(deliveryID); errors.Is(err, ErrDeliveryNotFound) {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(struct {
+		ID string `json:"id"`
+	}{ID: deliveryID})
+}
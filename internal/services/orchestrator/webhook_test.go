@@ -0,0 +1,168 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+)
+
+func TestWebhookDeliveredWithSignature(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	st := NewStore(env.DefaultOrchestratorConfig())
+	notifier := NewNotifier("secret", 3, time.Millisecond)
+	notifier.AllowPrivateTargets = true
+	st.OnExpressionFinished(notifier.Notify)
+	o := &Orchestrator{Store: st, Webhooks: notifier}
+
+	expr, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "42", CallbackURL: server.URL}, "")
+	if err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		if got, want := r.Header.Get(SignatureHeader), Sign([]byte("secret"), body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("webhook was not delivered")
+	}
+
+	var attempts []DeliveryAttempt
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if attempts = notifier.Deliveries(expr.Id); len(attempts) > 0 {
+			break
+		}
+	}
+	if len(attempts) != 1 || attempts[0].StatusCode != http.StatusOK {
+		t.Errorf("Deliveries() = %+v, want one successful attempt", attempts)
+	}
+}
+
+func TestRejectedExpressionSendsNoWebhook(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer server.Close()
+
+	st := NewStore(env.DefaultOrchestratorConfig())
+	notifier := NewNotifier("secret", 1, time.Millisecond)
+	notifier.AllowPrivateTargets = true
+	st.OnExpressionFinished(notifier.Notify)
+	o := &Orchestrator{Store: st, Webhooks: notifier}
+
+	for _, expression := range []string{"1/0", "2+", "2a"} {
+		if _, err := o.submitExpression(context.Background(), CalculateRequest{Expression: expression, CallbackURL: server.URL}, ""); err == nil {
+			t.Errorf("submitExpression(%q) accepted, want an error", expression)
+		}
+	}
+	if n := len(st.GetAllExpressions()); n != 0 {
+		t.Errorf("rejected submissions stored %d expressions, want none", n)
+	}
+
+	expr, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "42", CallbackURL: server.URL}, "")
+	if err != nil {
+		t.Fatalf("submitExpression unexpected error: %v", err)
+	}
+	for deadline := time.Now().Add(2 * time.Second); len(notifier.Deliveries(expr.Id)) == 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("webhook for the accepted expression was not delivered")
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("callback received %d requests, want only the accepted expression's", n)
+	}
+}
+
+func TestWebhookDeadLetterReplay(t *testing.T) {
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	notifier := NewNotifier("secret", 2, time.Millisecond)
+	notifier.AllowPrivateTargets = true
+	notifier.Notify(models.Expression{Id: 7, Status: models.StatusCompleted, CallbackURL: server.URL})
+
+	letters := notifier.DeadLetters()
+	if len(letters) != 1 || letters[0].ExpressionID != 7 {
+		t.Fatalf("DeadLetters() = %+v, want one letter for expression 7", letters)
+	}
+	if attempts := notifier.Deliveries(7); len(attempts) != 2 {
+		t.Errorf("Deliveries() recorded %d attempts, want 2", len(attempts))
+	}
+
+	healthy.Store(true)
+	done, err := notifier.Replay(letters[0].ID)
+	if err != nil {
+		t.Fatalf("Replay() unexpected error: %v", err)
+	}
+	if !<-done {
+		t.Fatal("replayed webhook was not delivered")
+	}
+	if len(notifier.DeadLetters()) != 0 {
+		t.Errorf("replayed letter should leave the dead-letter list")
+	}
+	if _, err := notifier.Replay(letters[0].ID); err != ErrDeliveryNotFound {
+		t.Errorf("second Replay() error = %v, want %v", err, ErrDeliveryNotFound)
+	}
+}
+
+func TestWebhookRefusesPrivateTargets(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer server.Close()
+
+	notifier := NewNotifier("secret", 1, time.Millisecond)
+	notifier.Notify(models.Expression{Id: 3, Status: models.StatusCompleted, CallbackURL: server.URL})
+	if hits.Load() != 0 {
+		t.Errorf("loopback callback was called %d times", hits.Load())
+	}
+	if attempts := notifier.Deliveries(3); len(attempts) != 1 || !strings.Contains(attempts[0].Error, ErrForbiddenCallbackTarget.Error()) {
+		t.Errorf("Deliveries() = %+v, want one attempt refused as non-public", attempts)
+	}
+
+	notifier.Forget(3)
+	if len(notifier.Deliveries(3)) != 0 || len(notifier.DeadLetters()) != 0 {
+		t.Error("Forget() kept the delivery log or dead letters")
+	}
+}
+
+func TestCallbackRequiresSecret(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig()), Webhooks: NewNotifier("", 1, time.Millisecond)}
+	if _, err := o.submitExpression(context.Background(), CalculateRequest{Expression: "1+1", CallbackURL: "https://example.com/hook"}, ""); !errors.Is(err, ErrWebhooksDisabled) {
+		t.Errorf("submitExpression error = %v, want %v", err, ErrWebhooksDisabled)
+	}
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	for _, raw := range []string{"ftp://example.com", "not a url", "http://"} {
+		if err := ValidateCallbackURL(raw); err == nil {
+			t.Errorf("ValidateCallbackURL(%q) should fail", raw)
+		}
+	}
+}
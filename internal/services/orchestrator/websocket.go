@@ -0,0 +1,166 @@
+package orchestrator
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/pAran0k/calc_go/models"
+)
+
+type wsRequest struct {
+	Type          string `json:"type"`
+	CorrelationID string `json:"correlation_id"`
+	ID            int    `json:"id,omitempty"`
+	CalculateRequest
+}
+
+type wsResponse struct {
+	Type          string `json:"type"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	ID            int    `json:"id,omitempty"`
+	Event         any    `json:"event,omitempty"`
+	Expression    any    `json:"expression,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+type wsSession struct {
+	o       *Orchestrator
+	conn    *websocket.Conn
+	owner   string
+	version int
+	writeMu sync.Mutex
+	wg      sync.WaitGroup
+}
+
+// checkOrigin lets browsers connect only from the orchestrator's own host or
+// an allowed origin, so other sites cannot open sessions with the user's
+// credentials. Clients that send no Origin are not browsers and pass.
+func (o *Orchestrator) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range o.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	slog.Warn("websocket origin rejected", "origin", origin)
+	return false
+}
+
+func (o *Orchestrator) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: o.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Warn("websocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	session := &wsSession{o: o, conn: conn, owner: r.Header.Get("X-User-ID"), version: apiVersion(r)}
+	defer session.wg.Wait()
+	defer cancel()
+
+	for {
+		var req wsRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.Warn("websocket read failed", "error", err)
+			}
+			return
+		}
+		session.handle(ctx, req)
+	}
+}
+
+func (s *wsSession) handle(ctx context.Context, req wsRequest) {
+	switch req.Type {
+	case "submit":
+		if req.Expression == "" {
+			s.send(wsResponse{Type: "error", CorrelationID: req.CorrelationID, Error: "invalid request"})
+			return
+		}
+		expr, err := s.o.submitExpression(ctx, req.CalculateRequest, s.owner)
+		if err != nil {
+			s.send(wsResponse{Type: "error", CorrelationID: req.CorrelationID, ID: expr.Id, Error: err.Error()})
+			return
+		}
+		s.o.persist()
+		s.send(wsResponse{Type: "accepted", CorrelationID: req.CorrelationID, ID: expr.Id})
+		s.watch(ctx, req.CorrelationID, expr.Id)
+	case "watch":
+		if !s.owns(req.ID) {
+			s.send(wsResponse{Type: "error", CorrelationID: req.CorrelationID, ID: req.ID, Error: ErrExpressionNotFound.Error()})
+			return
+		}
+		s.watch(ctx, req.CorrelationID, req.ID)
+	case "cancel":
+		if !s.owns(req.ID) {
+			s.send(wsResponse{Type: "error", CorrelationID: req.CorrelationID, ID: req.ID, Error: ErrExpressionNotFound.Error()})
+			return
+		}
+		if _, err := s.o.Store.CancelExpression(req.ID); err != nil {
+			s.send(wsResponse{Type: "error", CorrelationID: req.CorrelationID, ID: req.ID, Error: err.Error()})
+			return
+		}
+		s.o.persist()
+	default:
+		s.send(wsResponse{Type: "error", CorrelationID: req.CorrelationID, Error: "unknown message type: " + req.Type})
+	}
+}
+
+// owns reports whether the expression exists and belongs to the session's
+// user. Expressions of other users are reported to the client as missing.
+func (s *wsSession) owns(id int) bool {
+	expr, exists := s.o.Store.GetExpression(id)
+	return exists && expr.Owner == s.owner
+}
+
+func (s *wsSession) watch(ctx context.Context, correlationID string, id int) {
+	events, unsubscribe := s.o.Store.Events.Subscribe(id)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer unsubscribe()
+
+		if expr, exists := s.o.Store.GetExpression(id); exists && expr.Status.IsFinal() {
+			s.sendResult(correlationID, expr)
+			return
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-events:
+				if event.Type == EventExpressionFinished && event.Expression != nil {
+					s.sendResult(correlationID, *event.Expression)
+					return
+				}
+				s.send(wsResponse{Type: "event", CorrelationID: correlationID, ID: id, Event: event})
+			}
+		}
+	}()
+}
+
+func (s *wsSession) sendResult(correlationID string, expr models.Expression) {
+	s.send(wsResponse{Type: "result", CorrelationID: correlationID, ID: expr.Id, Expression: presentExpression(expr, s.version)})
+}
+
+func (s *wsSession) send(resp wsResponse) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := s.conn.WriteJSON(resp); err != nil {
+		slog.Warn("websocket write failed", "error", err)
+	}
+}
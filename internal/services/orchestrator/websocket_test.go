@@ -0,0 +1,113 @@
+package orchestrator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pAran0k/calc_go/env"
+	"github.com/pAran0k/calc_go/models"
+)
+
+func TestWebSocketSubmitAndWatch(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig())}
+	server := httptest.NewServer(http.HandlerFunc(o.handleWebSocket))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v2/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	conn.WriteJSON(map[string]string{"type": "submit", "correlation_id": "slow", "expression": "1+2"})
+	conn.WriteJSON(map[string]string{"type": "submit", "correlation_id": "fast", "expression": "7"})
+	conn.WriteJSON(map[string]string{"type": "submit", "correlation_id": "bad", "expression": "1+"})
+
+	results := make(map[string]wsResponse)
+	for len(results) < 3 {
+		var resp struct {
+			wsResponse
+			Expression models.Expression `json:"expression"`
+		}
+		if err := conn.ReadJSON(&resp); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		switch resp.Type {
+		case "accepted":
+			if resp.CorrelationID == "slow" {
+				task, ok := o.Store.GetPendingTask()
+				if !ok {
+					t.Fatalf("task for slow expression is not pending")
+				}
+				o.Store.UpdateTask(models.Result{TaskID: task.ID, Value: 3}, "")
+			}
+		case "result":
+			if resp.Expression.Status != models.StatusCompleted {
+				t.Errorf("%s: status = %s, want completed", resp.CorrelationID, resp.Expression.Status)
+			}
+			resp.wsResponse.Expression = resp.Expression.Result
+			results[resp.CorrelationID] = resp.wsResponse
+		case "error":
+			results[resp.CorrelationID] = resp.wsResponse
+		}
+	}
+
+	if results["slow"].Expression != 3.0 || results["fast"].Expression != 7.0 {
+		t.Errorf("unexpected results: %+v", results)
+	}
+	if results["bad"].Type != "error" || results["bad"].Error == "" {
+		t.Errorf("invalid expression should produce an error message, got %+v", results["bad"])
+	}
+}
+
+func TestWebSocketChecksOriginAndOwner(t *testing.T) {
+	o := &Orchestrator{Store: NewStore(env.DefaultOrchestratorConfig()), AllowedOrigins: []string{"https://calc.example"}}
+	server := httptest.NewServer(http.HandlerFunc(o.handleWebSocket))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v2/ws"
+
+	for origin, want := range map[string]bool{
+		"":                     true,
+		server.URL:             true,
+		"https://calc.example": true,
+		"https://evil.example": false,
+	} {
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+		if (err == nil) != want {
+			t.Errorf("dial with origin %q: err = %v, want allowed %v", origin, err, want)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	}
+
+	o.Store.AddExpression(models.Expression{Id: 1, Status: models.StatusProcessing, Owner: "alice"})
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"X-User-Id": {"mallory"}})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	conn.WriteJSON(map[string]any{"type": "watch", "correlation_id": "w", "id": 1})
+	var resp wsResponse
+	if err := conn.ReadJSON(&resp); err != nil || resp.Type != "error" {
+		t.Errorf("watch of another user's expression = %+v (%v), want an error", resp, err)
+	}
+	conn.WriteJSON(map[string]any{"type": "cancel", "correlation_id": "c", "id": 1})
+	if err := conn.ReadJSON(&resp); err != nil || resp.Type != "error" || resp.CorrelationID != "c" {
+		t.Errorf("cancel of another user's expression = %+v (%v), want an error", resp, err)
+	}
+	if expr, _ := o.Store.GetExpression(1); expr.Status != models.StatusProcessing {
+		t.Errorf("status = %s, want it unchanged", expr.Status)
+	}
+}
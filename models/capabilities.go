@@ -0,0 +1,75 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Operations lists every operation a task can carry.
+var Operations = []string{"+", "-", "*", "/"}
+
+// Capabilities is what an agent declares when it polls for work: the
+// operations it runs and free-form labels such as "bignum". An empty
+// operation list means every operation.
+type Capabilities struct {
+	Operations []string `json:"operations,omitempty"`
+	Labels     []string `json:"labels,omitempty"`
+}
+
+// ParseCapabilities reads comma-separated operation and label lists.
+func ParseCapabilities(operations, labels string) (Capabilities, error) {
+	var caps Capabilities
+	for _, op := range splitList(operations) {
+		if !slices.Contains(Operations, op) {
+			return Capabilities{}, fmt.Errorf("unknown operation: %s", op)
+		}
+		caps.Operations = append(caps.Operations, op)
+	}
+	var err error
+	if caps.Labels, err = ParseLabels(splitList(labels)); err != nil {
+		return Capabilities{}, err
+	}
+	return caps, nil
+}
+
+// ParseLabels normalizes labels to lower case and drops duplicates. Labels
+// may not contain commas, which separate them on the wire.
+func ParseLabels(labels []string) ([]string, error) {
+	var parsed []string
+	for _, label := range labels {
+		label = strings.ToLower(strings.TrimSpace(label))
+		if label == "" || strings.Contains(label, ",") {
+			return nil, fmt.Errorf("invalid label: %q", label)
+		}
+		if !slices.Contains(parsed, label) {
+			parsed = append(parsed, label)
+		}
+	}
+	slices.Sort(parsed)
+	return parsed, nil
+}
+
+// Accepts reports whether an agent with these capabilities can run task:
+// it supports the operation and has every label the task requires.
+func (c Capabilities) Accepts(task Task) bool {
+	if len(c.Operations) > 0 && !slices.Contains(c.Operations, task.Operation) {
+		return false
+	}
+	for _, label := range task.Labels {
+		if !slices.Contains(c.Labels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// OperationCosts is the simulated duration of each arithmetic operation.
+type OperationCosts struct {
+	AdditionMS       int `json:"addition_ms"`
+	SubtractionMS    int `json:"subtraction_ms"`
+	MultiplicationMS int `json:"multiplication_ms"`
+	DivisionMS       int `json:"division_ms"`
+}
+
+// OperationCostsPatch holds the costs a partial update changes; nil fields
+// keep their current value.
+type OperationCostsPatch struct {
+	AdditionMS       *int `json:"addition_ms"`
+	SubtractionMS    *int `json:"subtraction_ms"`
+	MultiplicationMS *int `json:"multiplication_ms"`
+	DivisionMS       *int `json:"division_ms"`
+}
+
+// Apply returns c with the fields set in p replaced.
+func (p OperationCostsPatch) Apply(c OperationCosts) OperationCosts {
+	for _, field := range []struct {
+		value *int
+		cost  *int
+	}{
+		{p.AdditionMS, &c.AdditionMS},
+		{p.SubtractionMS, &c.SubtractionMS},
+		{p.MultiplicationMS, &c.MultiplicationMS},
+		{p.DivisionMS, &c.DivisionMS},
+	} {
+		if field.value != nil {
+			*field.cost = *field.value
+		}
+	}
+	return c
+}
+
+// For returns the cost of operation, or false for an unknown operation.
+func (c OperationCosts) For(operation string) (time.Duration, bool) {
+	var ms int
+	switch operation {
+	case "+":
+		ms = c.AdditionMS
+	case "-":
+		ms = c.SubtractionMS
+	case "*":
+		ms = c.MultiplicationMS
+	case "/":
+		ms = c.DivisionMS
+	default:
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+func (c OperationCosts) Validate() error {
+	for _, cost := range []struct {
+		name string
+		ms   int
+	}{
+		{"addition_ms", c.AdditionMS},
+		{"subtraction_ms", c.SubtractionMS},
+		{"multiplication_ms", c.MultiplicationMS},
+		{"division_ms", c.DivisionMS},
+	} {
+		if cost.ms < 0 {
+			return fmt.Errorf("%s must not be negative, got %d", cost.name, cost.ms)
+		}
+	}
+	return nil
+}
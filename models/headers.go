@@ -0,0 +1,9 @@
+package models
+
+// Headers an agent sends with its requests to the orchestrator.
+const (
+	AgentIDHeader         = "X-Agent-ID"
+	AgentWorkerHeader     = "X-Agent-Worker"
+	AgentOperationsHeader = "X-Agent-Operations"
+	AgentLabelsHeader     = "X-Agent-Labels"
+)
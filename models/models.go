@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Node struct {
 	Value string `json:"value"`
 	Left  *Node  `json:"left,omitempty"`
@@ -11,20 +13,63 @@ type Task struct {
 	Arg1      string  `json:"arg1"`
 	Arg2      string  `json:"arg2"`
 	Operation string  `json:"operation"`
+	Hash      string  `json:"hash,omitempty"`
 	Result    float64 `json:"result,omitempty"`
 	Completed bool    `json:"completed"`
+	// OperationTime is the simulated duration of the operation in
+	// milliseconds, set by the orchestrator when it dispatches the task.
+	OperationTime int `json:"operation_time"`
+	// TimeoutMS is what is left of the expression deadline when the task is
+	// dispatched; the agent gives up on the task once it runs out.
+	TimeoutMS int `json:"timeout_ms,omitempty"`
+	// Labels are required of the agent that runs the task; they come from
+	// the expression the task was built for.
+	Labels []string `json:"labels,omitempty"`
+	// Trace carries the W3C trace context of the expression the task belongs
+	// to; it travels in HTTP headers rather than in the JSON body.
+	Trace map[string]string `json:"-"`
 }
 
 type Result struct {
-	TaskID string  `json:"task_id"`
-	Value  float64 `json:"value"`
-	Error  string  `json:"error,omitempty"`
+	TaskID   string  `json:"task_id"`
+	Value    float64 `json:"value"`
+	Error    string  `json:"error,omitempty"`
+	Attempts int     `json:"attempts,omitempty"`
 }
 
 type Expression struct {
-	Name   string  `json:"name"`
-	Status int     `json:"status"`
-	Id     int     `json:"id"`
-	Result float64 `json:"result"`
-	Node   *Node   `json:"node,omitempty"`
+	Name         string     `json:"name"`
+	Status       Status     `json:"status"`
+	Id           int        `json:"id"`
+	Result       float64    `json:"result"`
+	Error        string     `json:"error,omitempty"`
+	Node         *Node      `json:"node,omitempty"`
+	TasksSaved   int        `json:"tasks_saved,omitempty"`
+	CriticalPath int        `json:"critical_path"`
+	Owner        string     `json:"owner,omitempty"`
+	Priority     Priority   `json:"priority,omitempty"`
+	CallbackURL  string     `json:"callback_url,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	Deadline     *time.Time `json:"deadline,omitempty"`
+	Labels       []string   `json:"labels,omitempty"`
+	// UnroutableTasks counts pending tasks that no agent seen recently can
+	// run because of their operation or labels.
+	UnroutableTasks int `json:"unroutable_tasks,omitempty"`
+}
+
+type ExpressionV1 struct {
+	Expression
+	Status int `json:"status"`
+}
+
+// V1 presents the expression to v1 clients. They predate cancelled and
+// timed_out and see such expressions as failed; the error field says why.
+func (e Expression) V1() ExpressionV1 {
+	status := e.Status
+	if status == StatusCancelled || status == StatusTimedOut {
+		status = StatusFailed
+	}
+	return ExpressionV1{Expression: e, Status: int(status)}
 }
@@ -0,0 +1,38 @@
+package models
+
+import "fmt"
+
+// Priority is the scheduling class of an expression. Higher classes get a
+// larger share of agents while several expressions compete for them.
+type Priority string
+
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+var priorityWeights = map[Priority]float64{
+	PriorityHigh:   4,
+	PriorityNormal: 2,
+	PriorityLow:    1,
+}
+
+// ParsePriority accepts a class name; an empty value means normal.
+func ParsePriority(value string) (Priority, error) {
+	if value == "" {
+		return PriorityNormal, nil
+	}
+	if _, ok := priorityWeights[Priority(value)]; !ok {
+		return "", fmt.Errorf("unknown priority: %s", value)
+	}
+	return Priority(value), nil
+}
+
+// Weight is the share of dispatches a class gets relative to the others.
+func (p Priority) Weight() float64 {
+	if weight, ok := priorityWeights[p]; ok {
+		return weight
+	}
+	return priorityWeights[PriorityNormal]
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+type Status int
+
+const (
+	StatusCompleted Status = iota
+	StatusProcessing
+	StatusPending
+	StatusFailed
+	StatusCancelled
+	StatusTimedOut
+)
+
+var statusNames = map[Status]string{
+	StatusCompleted:  "completed",
+	StatusProcessing: "processing",
+	StatusPending:    "pending",
+	StatusFailed:     "failed",
+	StatusCancelled:  "cancelled",
+	StatusTimedOut:   "timed_out",
+}
+
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return strconv.Itoa(int(s))
+}
+
+func (s Status) IsFinal() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCancelled || s == StatusTimedOut
+}
+
+func ParseStatus(value string) (Status, error) {
+	for status, name := range statusNames {
+		if name == value {
+			return status, nil
+		}
+	}
+	if code, err := strconv.Atoi(value); err == nil {
+		if _, ok := statusNames[Status(code)]; ok {
+			return Status(code), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown status: %s", value)
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *Status) UnmarshalJSON(data []byte) error {
+	var code int
+	if err := json.Unmarshal(data, &code); err == nil {
+		*s = Status(code)
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	status, err := ParseStatus(name)
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
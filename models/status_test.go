@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestExpressionStatusJSON(t *testing.T) {
+	expr := Expression{Id: 1, Status: StatusFailed, Error: "division by zero"}
+
+	v2, err := json.Marshal(expr)
+	if err != nil {
+		t.Fatalf("marshal v2: %v", err)
+	}
+	if !strings.Contains(string(v2), `"status":"failed"`) {
+		t.Errorf("v2 JSON %s should contain string status", v2)
+	}
+
+	v1, err := json.Marshal(expr.V1())
+	if err != nil {
+		t.Fatalf("marshal v1: %v", err)
+	}
+	if !strings.Contains(string(v1), `"status":3`) || strings.Count(string(v1), `"status"`) != 1 {
+		t.Errorf("v1 JSON %s should contain a single integer status", v1)
+	}
+
+	var decoded Expression
+	if err := json.Unmarshal(v1, &decoded); err != nil || decoded.Status != StatusFailed {
+		t.Errorf("unmarshal v1 = %v, %v, want %v", decoded.Status, err, StatusFailed)
+	}
+
+	for _, status := range []Status{StatusCancelled, StatusTimedOut} {
+		finished := Expression{Id: 2, Status: status}
+		if got := finished.V1().Status; got != int(StatusFailed) {
+			t.Errorf("v1 status of a %s expression = %d, want %d", status, got, StatusFailed)
+		}
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	for _, value := range []string{"cancelled", "4"} {
+		if status, err := ParseStatus(value); err != nil || status != StatusCancelled {
+			t.Errorf("ParseStatus(%q) = %v, %v, want %v", value, status, err, StatusCancelled)
+		}
+	}
+	if _, err := ParseStatus("unknown"); err == nil {
+		t.Errorf("ParseStatus should reject unknown names")
+	}
+}
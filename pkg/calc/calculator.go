@@ -2,7 +2,6 @@ package calculations
 
 import (
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"unicode"
@@ -139,6 +138,9 @@ func BuildTasks(exprID string, root *models.Node) ([]models.Task, error) {
 
 	var tasks []models.Task
 	var taskCounter int
+	seen := make(map[string]string)
+	hashes := make(map[*models.Node]string)
+	hashTree(root, hashes)
 
 	var buildTask func(node *models.Node) (string, error)
 	buildTask = func(node *models.Node) (string, error) {
@@ -156,6 +158,11 @@ func BuildTasks(exprID string, root *models.Node) ([]models.Task, error) {
 			}
 		}
 
+		hash := hashes[node]
+		if taskID, ok := seen[hash]; ok {
+			return taskID, nil
+		}
+
 		leftArg, err := buildTask(node.Left)
 		if err != nil {
 			return "", err
@@ -173,8 +180,10 @@ func BuildTasks(exprID string, root *models.Node) ([]models.Task, error) {
 			Arg1:      leftArg,
 			Arg2:      rightArg,
 			Operation: node.Value,
+			Hash:      hash,
 			Completed: false,
 		}
+		seen[hash] = taskID
 		tasks = append(tasks, task)
 		return taskID, nil
 	}
@@ -187,6 +196,5 @@ func BuildTasks(exprID string, root *models.Node) ([]models.Task, error) {
 	for i, j := 0, len(tasks)-1; i < j; i, j = i+1, j-1 {
 		tasks[i], tasks[j] = tasks[j], tasks[i]
 	}
-	log.Printf("Сформированы задачи для %s: %+v", exprID, tasks)
 	return tasks, nil
 }
@@ -0,0 +1,142 @@
+package calculations
+
+import (
+	"testing"
+
+	"github.com/pAran0k/calc_go/models"
+)
+
+func buildTree(t *testing.T, expression string) *models.Node {
+	t.Helper()
+	rpn, err := ToRPN(expression)
+	if err != nil {
+		t.Fatalf("ToRPN(%q) unexpected error: %v", expression, err)
+	}
+	tree, err := ParseRPN(rpn)
+	if err != nil {
+		t.Fatalf("ParseRPN(%q) unexpected error: %v", rpn, err)
+	}
+	return tree
+}
+
+func TestHashNode(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"2*3", "3*2", true},
+		{"1+2", "2+1", true},
+		{"2-1", "1-2", false},
+		{"2/1", "1/2", false},
+		{"(1+2)*3", "3*(2+1)", true},
+		{"1.50+2", "1.5+2", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			got := HashNode(buildTree(t, tt.a)) == HashNode(buildTree(t, tt.b))
+			if got != tt.equal {
+				t.Errorf("HashNode(%q) == HashNode(%q) is %v, want %v", tt.a, tt.b, got, tt.equal)
+			}
+		})
+	}
+}
+
+func TestBuildTasksDeduplicatesSubtrees(t *testing.T) {
+	tasks, err := BuildTasks("expr-1", buildTree(t, "(2*3)+(3*2)"))
+	if err != nil {
+		t.Fatalf("BuildTasks unexpected error: %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("BuildTasks returned %d tasks, want 2: %+v", len(tasks), tasks)
+	}
+	root := tasks[0]
+	if root.Arg1 != root.Arg2 || root.Arg1 != tasks[1].ID {
+		t.Errorf("root task %+v should reference %s twice", root, tasks[1].ID)
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		expression string
+		opts       OptimizeOptions
+		want       string
+		saved      int
+	}{
+		{"(1+2)*3", AllOptimizations(), "*", 1},
+		{"2*3", OptimizeOptions{FoldConstants: true}, "6", 1},
+		{"(1+2)*(3+4)-5/5", OptimizeOptions{FoldConstants: true}, "-", 3},
+		{"(2+3)*1", OptimizeOptions{Identities: true}, "+", 1},
+		{"0*((2+3)*(4+5))", OptimizeOptions{Annihilators: true}, "0", 4},
+		{"0*(1/0)", OptimizeOptions{Annihilators: true}, "*", 0},
+		{"0*(1/(2-2))", OptimizeOptions{Annihilators: true}, "*", 0},
+		{"0*(1/(2-2))", AllOptimizations(), "*", 1},
+		{"0*(4/2)", AllOptimizations(), "0", 2},
+		{"(2+3)*1", OptimizeOptions{}, "*", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			tree, saved := Optimize(buildTree(t, tt.expression), tt.opts)
+			if tree.Value != tt.want {
+				t.Errorf("Optimize(%q) root = %q, want %q", tt.expression, tree.Value, tt.want)
+			}
+			if saved != tt.saved {
+				t.Errorf("Optimize(%q) saved %d tasks, want %d", tt.expression, saved, tt.saved)
+			}
+		})
+	}
+}
+
+func TestFoldingKeepsAgentTasks(t *testing.T) {
+	tree, _ := Optimize(buildTree(t, "((1+2)*(3+4)-(5*6))/(7-8+9)"), AllOptimizations())
+	tasks, err := BuildTasks("expr-1", tree)
+	if err != nil {
+		t.Fatalf("BuildTasks unexpected error: %v", err)
+	}
+	if len(tasks) != 4 {
+		t.Errorf("BuildTasks returned %d tasks after folding, want 4: %+v", len(tasks), tasks)
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	tests := []struct {
+		expression string
+		before     int
+		after      int
+	}{
+		{"1+2+3+4+5+6+7+8", 7, 3},
+		{"2*3*4*5", 3, 2},
+		{"1-2-3-4", 3, 3},
+		{"(1+2+3+4)*(5-6)", 4, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			tree := buildTree(t, tt.expression)
+			if got := CriticalPathDepth(tree); got != tt.before {
+				t.Errorf("CriticalPathDepth before = %d, want %d", got, tt.before)
+			}
+			want := evaluate(t, tree)
+			balanced := Rebalance(tree)
+			if got := CriticalPathDepth(balanced); got != tt.after {
+				t.Errorf("CriticalPathDepth after = %d, want %d", got, tt.after)
+			}
+			if got := evaluate(t, balanced); got != want {
+				t.Errorf("Rebalance changed value: %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func evaluate(t *testing.T, node *models.Node) float64 {
+	t.Helper()
+	if value, ok := literalValue(node); ok {
+		return value
+	}
+	value, ok := fold(node.Value, evaluate(t, node.Left), evaluate(t, node.Right))
+	if !ok {
+		t.Fatalf("cannot evaluate %s", node.Value)
+	}
+	return value
+}
@@ -0,0 +1,49 @@
+package calculations
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/pAran0k/calc_go/models"
+)
+
+func HashNode(node *models.Node) string {
+	return hashTree(node, nil)
+}
+
+// hashTree hashes every node once, bottom-up, and records operator node
+// hashes in hashes when it is not nil.
+func hashTree(node *models.Node, hashes map[*models.Node]string) string {
+	if node == nil {
+		return ""
+	}
+
+	if !IsOperator(node.Value) {
+		value := node.Value
+		if num, err := strconv.ParseFloat(node.Value, 64); err == nil {
+			value = strconv.FormatFloat(num, 'g', -1, 64)
+		}
+		return hashString("num:" + value)
+	}
+
+	left := hashTree(node.Left, hashes)
+	right := hashTree(node.Right, hashes)
+	if isCommutative(node.Value) && right < left {
+		left, right = right, left
+	}
+	hash := hashString("op:" + node.Value + "(" + left + "," + right + ")")
+	if hashes != nil {
+		hashes[node] = hash
+	}
+	return hash
+}
+
+func isCommutative(op string) bool {
+	return op == "+" || op == "*"
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,134 @@
+package calculations
+
+import (
+	"strconv"
+
+	"github.com/pAran0k/calc_go/models"
+)
+
+type OptimizeOptions struct {
+	Identities    bool `json:"identities"`
+	Annihilators  bool `json:"annihilators"`
+	FoldConstants bool `json:"fold_constants"`
+}
+
+func AllOptimizations() OptimizeOptions {
+	return OptimizeOptions{Identities: true, Annihilators: true, FoldConstants: true}
+}
+
+func Optimize(root *models.Node, opts OptimizeOptions) (*models.Node, int) {
+	before := CountOperations(root)
+	optimized := optimizeNode(root, opts)
+	return optimized, before - CountOperations(optimized)
+}
+
+func CountOperations(node *models.Node) int {
+	if node == nil || !IsOperator(node.Value) {
+		return 0
+	}
+	return 1 + CountOperations(node.Left) + CountOperations(node.Right)
+}
+
+func optimizeNode(node *models.Node, opts OptimizeOptions) *models.Node {
+	if node == nil || !IsOperator(node.Value) {
+		return node
+	}
+
+	left := optimizeNode(node.Left, opts)
+	right := optimizeNode(node.Right, opts)
+	result := &models.Node{Value: node.Value, Left: left, Right: right}
+
+	leftNum, leftIsNum := literalValue(left)
+	rightNum, rightIsNum := literalValue(right)
+
+	// Only a single operation on literals written in the expression is
+	// cheap enough to fold here; larger literal-only subtrees still go to
+	// the agents.
+	if opts.FoldConstants && isLiteral(node.Left) && isLiteral(node.Right) {
+		if value, ok := fold(node.Value, leftNum, rightNum); ok {
+			return literalNode(value)
+		}
+		return result
+	}
+
+	// A division left after constant folding may still have a zero divisor,
+	// so 0*x is only folded when x divides nothing.
+	if opts.Annihilators && node.Value == "*" {
+		if leftIsNum && leftNum == 0 && !hasDivision(right) {
+			return literalNode(0)
+		}
+		if rightIsNum && rightNum == 0 && !hasDivision(left) {
+			return literalNode(0)
+		}
+	}
+
+	if opts.Identities {
+		switch node.Value {
+		case "+":
+			if leftIsNum && leftNum == 0 {
+				return right
+			}
+			if rightIsNum && rightNum == 0 {
+				return left
+			}
+		case "-":
+			if rightIsNum && rightNum == 0 {
+				return left
+			}
+		case "*":
+			if leftIsNum && leftNum == 1 {
+				return right
+			}
+			if rightIsNum && rightNum == 1 {
+				return left
+			}
+		case "/":
+			if rightIsNum && rightNum == 1 {
+				return left
+			}
+		}
+	}
+
+	return result
+}
+
+func fold(op string, a, b float64) (float64, bool) {
+	switch op {
+	case "+":
+		return a + b, true
+	case "-":
+		return a - b, true
+	case "*":
+		return a * b, true
+	case "/":
+		if b == 0 {
+			return 0, false
+		}
+		return a / b, true
+	}
+	return 0, false
+}
+
+func hasDivision(node *models.Node) bool {
+	if node == nil || !IsOperator(node.Value) {
+		return false
+	}
+	return node.Value == "/" || hasDivision(node.Left) || hasDivision(node.Right)
+}
+
+func literalValue(node *models.Node) (float64, bool) {
+	if node == nil || IsOperator(node.Value) {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(node.Value, 64)
+	return value, err == nil
+}
+
+func isLiteral(node *models.Node) bool {
+	_, ok := literalValue(node)
+	return ok
+}
+
+func literalNode(value float64) *models.Node {
+	return &models.Node{Value: strconv.FormatFloat(value, 'f', -1, 64)}
+}
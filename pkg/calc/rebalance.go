@@ -0,0 +1,44 @@
+package calculations
+
+import "github.com/pAran0k/calc_go/models"
+
+func Rebalance(node *models.Node) *models.Node {
+	if node == nil || !IsOperator(node.Value) {
+		return node
+	}
+
+	if !isCommutative(node.Value) {
+		return &models.Node{Value: node.Value, Left: Rebalance(node.Left), Right: Rebalance(node.Right)}
+	}
+
+	var operands []*models.Node
+	collectOperands(node, node.Value, &operands)
+	for i, operand := range operands {
+		operands[i] = Rebalance(operand)
+	}
+	return balance(node.Value, operands)
+}
+
+func CriticalPathDepth(node *models.Node) int {
+	if node == nil || !IsOperator(node.Value) {
+		return 0
+	}
+	return 1 + max(CriticalPathDepth(node.Left), CriticalPathDepth(node.Right))
+}
+
+func collectOperands(node *models.Node, op string, operands *[]*models.Node) {
+	if node != nil && node.Value == op {
+		collectOperands(node.Left, op, operands)
+		collectOperands(node.Right, op, operands)
+		return
+	}
+	*operands = append(*operands, node)
+}
+
+func balance(op string, operands []*models.Node) *models.Node {
+	if len(operands) == 1 {
+		return operands[0]
+	}
+	mid := len(operands) / 2
+	return &models.Node{Value: op, Left: balance(op, operands[:mid]), Right: balance(op, operands[mid:])}
+}
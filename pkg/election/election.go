@@ -0,0 +1,146 @@
+// Package election picks one leader among orchestrator replicas that share a
+// lock file. The lock is an OS file lock, so it is released when the holder
+// exits or crashes and leadership itself needs no lease. That covers only who
+// leads: the next leader still has to learn what the old one acknowledged, so
+// the orchestrator writes its shared snapshot before answering changes and
+// leases the tasks it dispatches to agents.
+package election
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrLocked = errors.New("lock held by another replica")
+
+type Elector struct {
+	path     string
+	id       string
+	addr     string
+	interval time.Duration
+	leader   atomic.Bool
+
+	mu       sync.Mutex
+	file     *os.File
+	onChange []func(leader bool)
+}
+
+// New returns an elector for replica id, reachable by other replicas at addr.
+// It retries the lock every interval while another replica holds it.
+func New(path, id, addr string, interval time.Duration) *Elector {
+	return &Elector{path: path, id: id, addr: addr, interval: interval}
+}
+
+func (e *Elector) ID() string { return e.id }
+
+func (e *Elector) IsLeader() bool { return e.leader.Load() }
+
+// OnChange registers a hook called with the new role whenever it changes.
+func (e *Elector) OnChange(hook func(leader bool)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onChange = append(e.onChange, hook)
+}
+
+// Leader returns the id of the current leader as recorded in the lock file.
+func (e *Elector) Leader() (string, error) {
+	id, _, err := e.record()
+	return id, err
+}
+
+// LeaderAddr returns the address the current leader is reachable at.
+func (e *Elector) LeaderAddr() (string, error) {
+	_, addr, err := e.record()
+	return addr, err
+}
+
+// record reads the id and address the leader wrote into the lock file, one
+// per line. Both are empty while nobody holds the lock.
+func (e *Elector) record() (id, addr string, err error) {
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return "", "", err
+	}
+	id, addr, _ = strings.Cut(strings.TrimSpace(string(data)), "\n")
+	return id, addr, nil
+}
+
+// Run campaigns until ctx is done and then resigns.
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		if !e.IsLeader() {
+			e.campaign()
+		}
+		select {
+		case <-ctx.Done():
+			e.Resign()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Elector) campaign() {
+	if err := os.MkdirAll(filepath.Dir(e.path), 0o755); err != nil {
+		slog.Error("leader election failed", "replica", e.id, "error", err)
+		return
+	}
+	file, err := os.OpenFile(e.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		slog.Error("leader election failed", "replica", e.id, "error", err)
+		return
+	}
+	if err := tryLock(file); err != nil {
+		file.Close()
+		if !errors.Is(err, ErrLocked) {
+			slog.Error("leader election failed", "replica", e.id, "error", err)
+		}
+		return
+	}
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(e.id+"\n"+e.addr+"\n"), 0)
+	}
+
+	e.mu.Lock()
+	e.file = file
+	e.mu.Unlock()
+	slog.Info("became leader", "replica", e.id)
+	e.setLeader(true)
+}
+
+// Resign gives up leadership so another replica can take over.
+func (e *Elector) Resign() {
+	e.mu.Lock()
+	file := e.file
+	e.file = nil
+	e.mu.Unlock()
+	if file == nil {
+		return
+	}
+	e.setLeader(false)
+	file.Truncate(0)
+	unlock(file)
+	file.Close()
+	slog.Info("leadership resigned", "replica", e.id)
+}
+
+func (e *Elector) setLeader(leader bool) {
+	if e.leader.Swap(leader) == leader {
+		return
+	}
+	e.mu.Lock()
+	hooks := append([]func(bool){}, e.onChange...)
+	e.mu.Unlock()
+	for _, hook := range hooks {
+		hook(leader)
+	}
+}
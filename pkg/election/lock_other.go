@@ -0,0 +1,14 @@
+//go:build !unix
+
+package election
+
+import (
+	"errors"
+	"os"
+)
+
+var errUnsupported = errors.New("leader election needs file locks, which are not supported on this platform")
+
+func tryLock(*os.File) error { return errUnsupported }
+
+func unlock(*os.File) error { return nil }
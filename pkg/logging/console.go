@@ -0,0 +1,120 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// ConsoleHandler writes compact single-line records for people watching a
+// terminal. With lang "ru" messages and level names are translated; messages
+// missing from the catalog are written as is.
+type ConsoleHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  slog.Leveler
+	lang   string
+	attrs  []slog.Attr
+	prefix string
+}
+
+func NewConsoleHandler(w io.Writer, level slog.Leveler, lang string) *ConsoleHandler {
+	return &ConsoleHandler{mu: &sync.Mutex{}, w: w, level: level, lang: strings.ToLower(lang)}
+}
+
+func (h *ConsoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *ConsoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	if !r.Time.IsZero() {
+		b.WriteString(r.Time.Format("15:04:05.000"))
+		b.WriteByte(' ')
+	}
+	fmt.Fprintf(&b, "%-7s %s", h.levelName(r.Level), h.translate(r.Message))
+
+	for _, attr := range h.attrs {
+		writeAttr(&b, "", attr)
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		writeAttr(&b, h.prefix, attr)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *ConsoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, attr := range attrs {
+		attr.Key = h.prefix + attr.Key
+		clone.attrs = append(clone.attrs, attr)
+	}
+	return &clone
+}
+
+func (h *ConsoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+func (h *ConsoleHandler) levelName(level slog.Level) string {
+	if h.lang != "ru" {
+		return level.String()
+	}
+	switch {
+	case level >= slog.LevelError:
+		return "ОШИБКА"
+	case level >= slog.LevelWarn:
+		return "ВНИМАНИЕ"
+	case level >= slog.LevelInfo:
+		return "ИНФО"
+	default:
+		return "ОТЛАДКА"
+	}
+}
+
+func (h *ConsoleHandler) translate(message string) string {
+	if h.lang == "ru" {
+		if translated, ok := messagesRU[message]; ok {
+			return translated
+		}
+	}
+	return message
+}
+
+func writeAttr(b *strings.Builder, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		for _, nested := range attr.Value.Group() {
+			groupPrefix := prefix
+			if attr.Key != "" {
+				groupPrefix += attr.Key + "."
+			}
+			writeAttr(b, groupPrefix, nested)
+		}
+		return
+	}
+
+	value := attr.Value.String()
+	if strings.ContainsAny(value, " \t\n\"=") {
+		value = fmt.Sprintf("%q", value)
+	}
+	fmt.Fprintf(b, " %s%s=%s", prefix, attr.Key, value)
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Stable attribute keys shared by the orchestrator and agents.
+const (
+	KeyExprID  = "expr_id"
+	KeyTaskID  = "task_id"
+	KeyAgentID = "agent_id"
+	KeyWorker  = "worker"
+)
+
+type Options struct {
+	Level  string
+	Format string
+	Lang   string
+	// Records below warning level are sampled per message: the first
+	// SampleFirst in each second pass, then every SampleThereafter-th.
+	SampleFirst      int
+	SampleThereafter int
+}
+
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "json":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	case "text":
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case "console":
+		handler = NewConsoleHandler(w, level, opts.Lang)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+
+	if opts.SampleFirst > 0 {
+		handler = NewSamplingHandler(handler, opts.SampleFirst, opts.SampleThereafter, time.Second)
+	}
+	return slog.New(handler), nil
+}
+
+func Setup(opts Options) error {
+	logger, err := New(os.Stderr, opts)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+func ParseLevel(value string) (slog.Level, error) {
+	if value == "" {
+		return slog.LevelInfo, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", value)
+	}
+	return level, nil
+}
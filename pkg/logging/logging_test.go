@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"", slog.LevelInfo, false},
+		{"debug", slog.LevelDebug, false},
+		{"WARN", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"verbose", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLevel(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestNewJSONUsesStableKeys(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{Level: "debug", Format: "json"})
+	if err != nil {
+		t.Fatalf("New unexpected error: %v", err)
+	}
+	logger.Debug("task dispatched", KeyExprID, 7, KeyTaskID, "task-expr-7-0")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("invalid JSON record %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "task dispatched" || record["expr_id"] != float64(7) || record["task_id"] != "task-expr-7-0" {
+		t.Errorf("unexpected record: %v", record)
+	}
+}
+
+func TestNewRejectsUnknownFormat(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, Options{Format: "xml"}); err == nil {
+		t.Error("New with unknown format expected error, got nil")
+	}
+}
+
+func TestConsoleHandlerTranslates(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewConsoleHandler(&buf, slog.LevelInfo, "ru")).With(KeyAgentID, "a1")
+	logger.Info("expression cancelled", KeyExprID, 3)
+	logger.Info("not in catalog", "note", "two words")
+	logger.Debug("task queued")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), buf.String())
+	}
+	if !strings.Contains(lines[0], "ИНФО") || !strings.Contains(lines[0], "Выражение отменено agent_id=a1 expr_id=3") {
+		t.Errorf("unexpected translated line: %q", lines[0])
+	}
+	if !strings.Contains(lines[1], `not in catalog agent_id=a1 note="two words"`) {
+		t.Errorf("unexpected untranslated line: %q", lines[1])
+	}
+}
+
+func TestSamplingHandler(t *testing.T) {
+	var buf bytes.Buffer
+	handler := NewSamplingHandler(slog.NewTextHandler(&buf, nil), 2, 3, time.Hour)
+	logger := slog.New(handler)
+
+	for i := 0; i < 8; i++ {
+		logger.Info("hot path")
+	}
+	logger.Info("other")
+	logger.Warn("hot path")
+
+	// 2 first + the 3rd and 6th after them, "other", and the warning.
+	if got := strings.Count(buf.String(), "\n"); got != 6 {
+		t.Errorf("got %d records, want 6:\n%s", got, buf.String())
+	}
+}
@@ -0,0 +1,91 @@
+package logging
+
+var messagesRU = map[string]string{
+	"agent drained":                                     "Агент завершил все задачи",
+	"agent draining":                                    "Агент завершает работу",
+	"agent http server failed":                          "Ошибка HTTP-сервера агента",
+	"agent http server listening":                       "HTTP-сервер агента запущен",
+	"agent started":                                     "Агент запущен",
+	"agent stopped with unreleased tasks":               "Агент остановлен, не вернув часть задач",
+	"application stopped":                               "Приложение остановлено",
+	"became leader":                                     "Реплика стала лидером",
+	"client disconnected before expression finished":    "Клиент отключился, не дождавшись выражения",
+	"config reload failed":                              "Ошибка перечитывания конфигурации",
+	"config reloaded":                                   "Конфигурация перечитана",
+	"dependency result requested for unknown task":      "Запрошен результат неизвестной задачи",
+	"dependency result served":                          "Возвращён результат задачи",
+	"drain deadline reached, releasing in-flight tasks": "Время на завершение истекло, задачи возвращаются оркестратору",
+	"event encoding failed":                             "Ошибка кодирования события",
+	"event stream client disconnected":                  "Клиент отключился от потока событий",
+	"expression accepted":                               "Выражение принято",
+	"expression cancelled":                              "Выражение отменено",
+	"expression completed without tasks":                "Выражение вычислено без задач",
+	"expression completed":                              "Выражение вычислено",
+	"expression evaluation failed":                      "Ошибка при вычислении выражения",
+	"expression failed":                                 "Выражение завершилось ошибкой",
+	"expression has tasks no agent can run":             "Ни один агент не может выполнить задачи выражения",
+	"expression optimized":                              "Выражение оптимизировано",
+	"expression scheduled":                              "Задачи выражения запланированы",
+	"expression served entirely from cache":             "Все задачи выражения взяты из кэша",
+	"expression stored":                                 "Выражение сохранено",
+	"expression timed out":                              "Истёк срок вычисления выражения",
+	"finished expression not overwritten":               "Завершённое выражение не перезаписано",
+	"invalid task result payload":                       "Ошибка декодирования результата",
+	"leader election failed":                            "Ошибка выбора лидера",
+	"leadership resigned":                               "Реплика сложила полномочия лидера",
+	"leadership taken over":                             "Лидер загрузил общее состояние",
+	"logging setup failed":                              "Ошибка настройки логирования",
+	"operation costs updated":                           "Стоимость операций изменена",
+	"orchestrator error on result":                      "Ошибка оркестратора при приёме результата",
+	"orchestrator failed":                               "Ошибка оркестратора",
+	"orchestrator server failed":                        "Ошибка сервера",
+	"orchestrator started":                              "Оркестратор запущен",
+	"orchestrator stopping":                             "Останавливаем оркестратор",
+	"request forwarding to leader failed":               "Не удалось переслать запрос лидеру",
+	"result delivery failed":                            "Ошибка при отправке результата",
+	"result delivery gave up":                           "Не удалось отправить результат после всех попыток",
+	"result for cancelled task discarded":               "Результат отменённой задачи отброшен",
+	"result for unknown task":                           "Результат для неизвестной задачи",
+	"result from an agent not holding the task":         "Результат от агента, которому задача не выдана",
+	"result request failed":                             "Ошибка отправки результата",
+	"result sent":                                       "Результат отправлен",
+	"shared snapshot load failed":                       "Не удалось загрузить общий снимок состояния",
+	"shutdown deadline reached with tasks in flight":    "Время на остановку истекло, часть задач не завершена",
+	"shutdown signal received":                          "Получен сигнал остановки",
+	"snapshot restore failed":                           "Ошибка восстановления снимка состояния",
+	"snapshot restored":                                 "Состояние восстановлено из снимка",
+	"snapshot write failed":                             "Ошибка записи снимка состояния",
+	"snapshot written":                                  "Снимок состояния записан",
+	"store purged":                                      "Хранилище очищено",
+	"task cancelled by orchestrator":                    "Задача отменена оркестратором",
+	"task cancelled, result discarded":                  "Задача отменена, результат отброшен",
+	"task cannot be computed":                           "Задача не может быть вычислена",
+	"task completed":                                    "Задача выполнена",
+	"task dispatched":                                   "Задача выдана агенту",
+	"task done":                                         "Вычислитель освободился",
+	"task deadline exceeded":                            "Истёк срок выполнения задачи",
+	"task failed":                                       "Задача завершилась ошибкой",
+	"task fetch failed":                                 "Ошибка при получении задачи",
+	"task lease expired":                                "Истёк срок аренды задачи, задача возвращена в очередь",
+	"task merged with in-flight task":                   "Задача совпадает с выполняющейся задачей",
+	"task processing failed":                            "Ошибка при обработке задачи",
+	"task queued":                                       "Задача поставлена в очередь",
+	"task received":                                     "Получена задача",
+	"task release failed":                               "Не удалось вернуть задачу оркестратору",
+	"task released back to queue":                       "Задача возвращена в очередь",
+	"task released to orchestrator":                     "Задача возвращена оркестратору",
+	"task result taken from cache":                      "Результат задачи взят из кэша",
+	"task result without task id":                       "Отсутствует идентификатор задачи в результате",
+	"task started":                                      "Задача принята вычислителем",
+	"tracing setup failed":                              "Ошибка настройки трассировки",
+	"unexpected status for result":                      "Неожиданный код ответа на результат",
+	"waiting for dependency result":                     "Ожидание результата зависимости",
+	"webhook delivered":                                 "Уведомление доставлено",
+	"webhook delivery failed":                           "Ошибка доставки уведомления",
+	"webhook moved to dead letters":                     "Уведомление перемещено в очередь недоставленных",
+	"webhook payload encoding failed":                   "Ошибка кодирования уведомления",
+	"websocket origin rejected":                         "Источник WebSocket-подключения отклонён",
+	"websocket read failed":                             "Ошибка чтения WebSocket-сообщения",
+	"websocket upgrade failed":                          "Ошибка установки WebSocket-соединения",
+	"websocket write failed":                            "Ошибка отправки WebSocket-сообщения",
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type samplingHandler struct {
+	next       slog.Handler
+	first      uint64
+	thereafter uint64
+	tick       time.Duration
+	counters   *sampleCounters
+}
+
+type sampleCounters struct {
+	mu     sync.Mutex
+	window time.Time
+	counts map[sampleKey]uint64
+}
+
+type sampleKey struct {
+	level   slog.Level
+	message string
+}
+
+// NewSamplingHandler limits how often the same informational message is
+// written: per tick, the first records pass and after that only every
+// thereafter-th one (none when thereafter is 0). Warnings and errors are never
+// sampled.
+func NewSamplingHandler(next slog.Handler, first, thereafter int, tick time.Duration) slog.Handler {
+	return &samplingHandler{
+		next:       next,
+		first:      uint64(first),
+		thereafter: uint64(thereafter),
+		tick:       tick,
+		counters:   &sampleCounters{counts: make(map[sampleKey]uint64)},
+	}
+}
+
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn || h.counters.allow(sampleKey{r.Level, r.Message}, r.Time, h) {
+		return h.next.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.next = h.next.WithAttrs(attrs)
+	return &clone
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.next = h.next.WithGroup(name)
+	return &clone
+}
+
+func (c *sampleCounters) allow(key sampleKey, now time.Time, h *samplingHandler) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.window) >= h.tick {
+		c.window = now
+		clear(c.counts)
+	}
+	c.counts[key]++
+	n := c.counts[key]
+	if n <= h.first {
+		return true
+	}
+	return h.thereafter > 0 && (n-h.first)%h.thereafter == 0
+}